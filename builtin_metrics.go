@@ -3,30 +3,76 @@ package elasticapm
 import (
 	"context"
 	"runtime"
-	"runtime/debug"
+	"sort"
+	"sync"
 	"time"
 )
 
 // builtinMetricsGatherer is an MetricsGatherer which gathers builtin metrics:
 //   - memstats (allocations, usage, GC, etc.)
-//   - goroutines
+//   - goroutines, GOMAXPROCS, and cgo calls
 //   - tracer stats (number of transactions/errors sent, dropped, etc.)
+//
+// Some metrics are reported as deltas since the previous gathering,
+// e.g. the GC pause quantiles and allocation rate, so that recent
+// changes are not hidden by the process's lifetime totals. These
+// are not reported until the second time metrics are gathered.
+//
+// The previous sample is held per instance, so each consumer of
+// the metrics must use its own instance; see newConsumer.
 type builtinMetricsGatherer struct {
 	tracer *Tracer
+
+	mu   sync.Mutex
+	last runtimeSample
+}
+
+// runtimeSample holds runtime statistics
+// from the previous gathering.
+type runtimeSample struct {
+	time         time.Time
+	numGC        uint32
+	pauseTotalNs uint64
+	totalAlloc   uint64
+	goroutines   int
+}
+
+// newConsumer returns a new builtinMetricsGatherer for the same
+// tracer, with no previous sample.
+func (g *builtinMetricsGatherer) newConsumer() MetricsGatherer {
+	return &builtinMetricsGatherer{tracer: g.tracer}
 }
 
 // GatherMetrics gathers mem metrics into m.
 func (g *builtinMetricsGatherer) GatherMetrics(ctx context.Context, m *Metrics) error {
-	m.AddGauge("go.goroutines", "", nil, float64(runtime.NumGoroutine()))
-	g.gatherMemStatsMetrics(m)
-	g.gatherTracerStatsMetrics(m)
-	return nil
-}
+	g.mu.Lock()
+	defer g.mu.Unlock()
 
-func (*builtinMetricsGatherer) gatherMemStatsMetrics(m *Metrics) {
 	var mem runtime.MemStats
 	runtime.ReadMemStats(&mem)
+	sample := runtimeSample{
+		time:         time.Now(),
+		numGC:        mem.NumGC,
+		pauseTotalNs: mem.PauseTotalNs,
+		totalAlloc:   mem.TotalAlloc,
+		goroutines:   runtime.NumGoroutine(),
+	}
+
+	m.AddGauge("go.goroutines", "", nil, float64(sample.goroutines))
+	m.AddGauge("go.gomaxprocs", "", nil, float64(runtime.GOMAXPROCS(0)))
+	m.AddCounter("go.cgo.calls", "", nil, float64(runtime.NumCgoCall()))
+	gatherMemStatsMetrics(m, &mem, g.last)
+	if !g.last.time.IsZero() {
+		gatherDeltaMetrics(m, g.last, sample)
+	}
+	g.gatherTracerStatsMetrics(m)
+	g.last = sample
+	return nil
+}
 
+// gatherMemStatsMetrics gathers memstats metrics into m. The GC
+// pause summary describes the pauses since last.
+func gatherMemStatsMetrics(m *Metrics, mem *runtime.MemStats, last runtimeSample) {
 	addCounterUint64 := func(name, unit string, v uint64) {
 		m.AddCounter(name, unit, nil, float64(v))
 	}
@@ -55,24 +101,59 @@ func (*builtinMetricsGatherer) gatherMemStatsMetrics(m *Metrics) {
 	addGauge("go.mem.gc.last", unitSecond, time.Duration(mem.LastGC).Seconds())
 	addGauge("go.mem.gc.cpu.pct", "", mem.GCCPUFraction*100)
 
-	gcStats := debug.GCStats{
-		PauseQuantiles: make([]time.Duration, 5),
-	}
-	debug.ReadGCStats(&gcStats)
-	gcPauseQuantiles := map[float64]float64{
-		0:    gcStats.PauseQuantiles[0].Seconds(),
-		0.25: gcStats.PauseQuantiles[1].Seconds(),
-		0.5:  gcStats.PauseQuantiles[2].Seconds(),
-		0.75: gcStats.PauseQuantiles[3].Seconds(),
-		1.0:  gcStats.PauseQuantiles[4].Seconds(),
+	// The GC pause count, sum, and quantiles all describe
+	// the pauses since metrics were last gathered.
+	gcPauseQuantiles := make(map[float64]float64)
+	if pauses := recentGCPauses(mem, last); len(pauses) > 0 {
+		for _, q := range []float64{0, 0.25, 0.5, 0.75, 1} {
+			gcPauseQuantiles[q] = pauses[int(q*float64(len(pauses)-1))].Seconds()
+		}
 	}
 	m.AddSummary("go.mem.gc.pause", unitSecond, nil, SummaryMetric{
-		Count:     uint64(gcStats.NumGC),
-		Sum:       gcStats.PauseTotal.Seconds(),
+		Count:     uint64(mem.NumGC - last.numGC),
+		Sum:       time.Duration(mem.PauseTotalNs - last.pauseTotalNs).Seconds(),
 		Quantiles: gcPauseQuantiles,
 	})
 }
 
+// recentGCPauses returns the GC pauses recorded in mem since the
+// last sample, in ascending order of duration. The runtime only
+// records the most recent 256 pauses; any earlier pauses are
+// omitted.
+func recentGCPauses(mem *runtime.MemStats, last runtimeSample) []time.Duration {
+	n := mem.NumGC - last.numGC
+	if max := uint32(len(mem.PauseNs)); n > max {
+		n = max
+	}
+	pauses := make([]time.Duration, n)
+	for i := range pauses {
+		// The most recent pause is at PauseNs[(NumGC+255)%256].
+		j := (mem.NumGC - uint32(i) + uint32(len(mem.PauseNs)) - 1) % uint32(len(mem.PauseNs))
+		pauses[i] = time.Duration(mem.PauseNs[j])
+	}
+	sort.Slice(pauses, func(i, j int) bool {
+		return pauses[i] < pauses[j]
+	})
+	return pauses
+}
+
+// gatherDeltaMetrics gathers metrics describing the change
+// in runtime statistics between the last and current samples.
+func gatherDeltaMetrics(m *Metrics, last, current runtimeSample) {
+	elapsed := current.time.Sub(last.time)
+	if elapsed <= 0 {
+		return
+	}
+	seconds := elapsed.Seconds()
+	m.AddGauge("go.mem.gc.count", "", nil, float64(current.numGC-last.numGC))
+	m.AddGauge("go.mem.heap.alloc_rate", "byte/sec", nil, float64(current.totalAlloc-last.totalAlloc)/seconds)
+
+	// The runtime does not expose the number of goroutines
+	// created, so we report the net change in the number of
+	// goroutines, which may be negative.
+	m.AddGauge("go.goroutines.delta", "", nil, float64(current.goroutines-last.goroutines))
+}
+
 func (g *builtinMetricsGatherer) gatherTracerStatsMetrics(m *Metrics) {
 	g.tracer.statsMu.Lock()
 	stats := g.tracer.stats
@@ -81,8 +162,10 @@ func (g *builtinMetricsGatherer) gatherTracerStatsMetrics(m *Metrics) {
 	const p = "elasticapm"
 	m.AddCounter(p+".transactions.sent", "", nil, float64(stats.TransactionsSent))
 	m.AddCounter(p+".transactions.dropped", "", nil, float64(stats.TransactionsDropped))
+	m.AddCounter(p+".transactions.filtered", "", nil, float64(stats.TransactionsFiltered))
 	m.AddCounter(p+".transactions.send_errors", "", nil, float64(stats.Errors.SendTransactions))
 	m.AddCounter(p+".errors.sent", "", nil, float64(stats.ErrorsSent))
 	m.AddCounter(p+".errors.dropped", "", nil, float64(stats.ErrorsDropped))
+	m.AddCounter(p+".errors.filtered", "", nil, float64(stats.ErrorsFiltered))
 	m.AddCounter(p+".errors.send_errors", "", nil, float64(stats.Errors.SendErrors))
 }
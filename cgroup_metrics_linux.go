@@ -0,0 +1,50 @@
+package elasticapm
+
+import (
+	"context"
+
+	"github.com/elastic/apm-agent-go/internal/cgroup"
+)
+
+// cgroupMetricsGatherer is a MetricsGatherer which gathers the
+// memory and CPU controller statistics of the process's cgroup,
+// reflecting container resource limits rather than host totals.
+type cgroupMetricsGatherer struct {
+	reader *cgroup.Reader
+}
+
+// newCgroupMetricsGatherer returns a new cgroupMetricsGatherer,
+// or nil if the process's cgroup controllers cannot be found.
+func newCgroupMetricsGatherer() MetricsGatherer {
+	reader, err := cgroup.NewReader(defaultProcfsRoot+"/self", "/sys/fs/cgroup")
+	if err != nil {
+		return nil
+	}
+	if _, err := reader.Read(); err != nil {
+		return nil
+	}
+	return &cgroupMetricsGatherer{reader: reader}
+}
+
+// GatherMetrics gathers cgroup metrics into m.
+func (g *cgroupMetricsGatherer) GatherMetrics(ctx context.Context, m *Metrics) error {
+	stats, err := g.reader.Read()
+	if err != nil {
+		return err
+	}
+	const p = "system.process.cgroup"
+	if stats.MemoryLimit > 0 {
+		m.AddGauge(p+".memory.limit", "byte", nil, float64(stats.MemoryLimit))
+	}
+	m.AddGauge(p+".memory.usage", "byte", nil, float64(stats.MemoryUsage))
+	if stats.CPUQuota > 0 {
+		m.AddGauge(p+".cpu.quota", "sec", nil, stats.CPUQuota.Seconds())
+	}
+	if stats.CPUPeriod > 0 {
+		m.AddGauge(p+".cpu.period", "sec", nil, stats.CPUPeriod.Seconds())
+	}
+	m.AddCounter(p+".cpu.periods", "", nil, float64(stats.CPUPeriods))
+	m.AddCounter(p+".cpu.throttled.periods", "", nil, float64(stats.CPUThrottledPeriods))
+	m.AddCounter(p+".cpu.throttled.time", "sec", nil, stats.CPUThrottledTime.Seconds())
+	return nil
+}
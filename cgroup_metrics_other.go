@@ -0,0 +1,9 @@
+//+build !linux
+
+package elasticapm
+
+// newCgroupMetricsGatherer returns nil, as cgroups
+// are only supported on Linux.
+func newCgroupMetricsGatherer() MetricsGatherer {
+	return nil
+}
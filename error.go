@@ -82,6 +82,7 @@ func (t *Tracer) NewError(err error) *Error {
 		panic("NewError must be called with a non-nil error")
 	}
 	e := t.newError()
+	e.cause = err
 	if uuid, err := uuid.NewV4(); err == nil {
 		e.ID = uuid.String()
 	}
@@ -136,6 +137,9 @@ func (t *Tracer) newError() *Error {
 type Error struct {
 	model           model.Error
 	tracer          *Tracer
+	cause           error
+	filtered        bool
+	parentID        int64
 	stacktrace      []stacktrace.Frame
 	modelStacktrace []model.StacktraceFrame
 
@@ -156,6 +160,14 @@ type Error struct {
 	// before the transaction's End method.
 	Transaction *Transaction
 
+	// Span is the span within which the error occurred, if any.
+	// If this is set, the error's Send method must be called before
+	// the span's transaction's End method. If Transaction is unset,
+	// it will be set to the span's transaction when the error is
+	// sent. If the span is dropped, or belongs to a transaction
+	// other than Transaction, it is ignored.
+	Span *Span
+
 	// Timestamp records the time at which the error occurred.
 	// This is set when the Error object is created, but may
 	// be overridden any time before the Send method is called.
@@ -1,6 +1,7 @@
 package elasticapm_test
 
 import (
+	"context"
 	"path/filepath"
 	"runtime"
 	"testing"
@@ -59,6 +60,47 @@ func TestInternalStackTrace(t *testing.T) {
 	}}, stacktrace)
 }
 
+func TestCaptureErrorSpan(t *testing.T) {
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	elasticapm.CaptureError(ctx, errors.New("no span")).Send()
+
+	span0 := tx.StartSpan("span0", "type", nil)
+	span1 := tx.StartSpan("span1", "type", span0)
+	ctx = elasticapm.ContextWithSpan(ctx, span1)
+	elasticapm.CaptureError(ctx, errors.New("span")).Send()
+	span1.End()
+	span0.End()
+
+	e := tracer.NewError(errors.New("explicit span"))
+	e.Span = span0
+	e.Send()
+	txID := tx.ID()
+	tx.End()
+	tracer.Flush(nil)
+
+	// The errors may be sent in multiple payloads,
+	// separately from the transaction.
+	var errs []*model.Error
+	for _, p := range r.Payloads() {
+		if _, ok := p.Value.(*model.ErrorsPayload); ok {
+			errs = append(errs, p.Errors()...)
+		}
+	}
+	require.Len(t, errs, 3)
+	for _, e := range errs {
+		assert.Equal(t, txID, e.Transaction.ID)
+	}
+	assert.Nil(t, errs[0].ParentID)
+	require.NotNil(t, errs[1].ParentID)
+	assert.Equal(t, int64(1), *errs[1].ParentID)
+	require.NotNil(t, errs[2].ParentID)
+	assert.Equal(t, int64(0), *errs[2].ParentID)
+}
+
 func sendError(t *testing.T, err error, f ...func(*elasticapm.Error)) *model.Error {
 	var r transporttest.RecorderTransport
 	tracer, newTracerErr := elasticapm.NewTracer("tracer_testing", "")
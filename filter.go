@@ -0,0 +1,60 @@
+package elasticapm
+
+import (
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// ErrorFilter provides an interface for filtering errors before
+// they are sent to the Elastic APM server.
+type ErrorFilter interface {
+	// FilterError is called with each error just before it is
+	// encoded and sent. FilterError may modify the event's model
+	// error, e.g. to remove sensitive information from its
+	// context. If FilterError returns false, the error will be
+	// dropped.
+	FilterError(*ErrorFilterEvent) bool
+}
+
+// ErrorFilterFunc is a function type implementing ErrorFilter.
+type ErrorFilterFunc func(*ErrorFilterEvent) bool
+
+// FilterError returns f(e).
+func (f ErrorFilterFunc) FilterError(e *ErrorFilterEvent) bool {
+	return f(e)
+}
+
+// ErrorFilterEvent holds an error to be filtered by an ErrorFilter.
+type ErrorFilterEvent struct {
+	// Error holds the model error to be sent.
+	Error *model.Error
+
+	// Cause holds the error passed to Tracer.NewError, or the
+	// error created by Tracer.Recovered. Cause is nil for errors
+	// created by Tracer.NewErrorLog.
+	Cause error
+}
+
+// TransactionFilter provides an interface for filtering
+// transactions before they are sent to the Elastic APM server.
+type TransactionFilter interface {
+	// FilterTransaction is called with each transaction just before
+	// it is encoded and sent. FilterTransaction may modify the event's
+	// model transaction, e.g. to add or remove context. If
+	// FilterTransaction returns false, the transaction will be dropped.
+	FilterTransaction(*TransactionFilterEvent) bool
+}
+
+// TransactionFilterFunc is a function type implementing TransactionFilter.
+type TransactionFilterFunc func(*TransactionFilterEvent) bool
+
+// FilterTransaction returns f(e).
+func (f TransactionFilterFunc) FilterTransaction(e *TransactionFilterEvent) bool {
+	return f(e)
+}
+
+// TransactionFilterEvent holds a transaction to be filtered by a
+// TransactionFilter.
+type TransactionFilterEvent struct {
+	// Transaction holds the model transaction to be sent.
+	Transaction *model.Transaction
+}
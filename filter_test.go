@@ -0,0 +1,103 @@
+package elasticapm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestTracerErrorFilter(t *testing.T) {
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.AddErrorFilter(elasticapm.ErrorFilterFunc(func(e *elasticapm.ErrorFilterEvent) bool {
+		return e.Cause != context.Canceled
+	}))
+	tracer.AddErrorFilter(elasticapm.ErrorFilterFunc(func(e *elasticapm.ErrorFilterEvent) bool {
+		e.Error.Culprit = "filtered"
+		return true
+	}))
+
+	tracer.NewError(context.Canceled).Send()
+	tracer.NewError(errors.New("boom")).Send()
+	tracer.NewErrorLog(elasticapm.ErrorLogRecord{Message: "log"}).Send()
+	tracer.Flush(nil)
+
+	// The errors may be sent in multiple payloads.
+	var errors []*model.Error
+	for _, p := range r.Payloads() {
+		errors = append(errors, p.Errors()...)
+	}
+	require.Len(t, errors, 2)
+	assert.Equal(t, "boom", errors[0].Exception.Message)
+	assert.Equal(t, "filtered", errors[0].Culprit)
+	assert.Equal(t, "log", errors[1].Log.Message)
+	assert.Equal(t, "filtered", errors[1].Culprit)
+
+	stats := tracer.Stats()
+	assert.Equal(t, uint64(1), stats.ErrorsFiltered)
+	assert.Equal(t, uint64(2), stats.ErrorsSent)
+}
+
+func TestTracerTransactionFilter(t *testing.T) {
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	remove := tracer.AddTransactionFilter(elasticapm.TransactionFilterFunc(func(e *elasticapm.TransactionFilterEvent) bool {
+		if e.Transaction.Name == "drop" {
+			return false
+		}
+		e.Transaction.Result = "filtered"
+		return true
+	}))
+
+	startTransaction := func(name string, spans int) {
+		tx := tracer.StartTransaction(name, "type")
+		for i := 0; i < spans; i++ {
+			span := tx.StartSpan(name, "type", nil)
+			span.SetStacktrace(0)
+			span.End()
+		}
+		tx.End()
+	}
+	startTransaction("keep0", 1)
+	startTransaction("drop", 2)
+	startTransaction("keep1", 3)
+	tracer.Flush(nil)
+
+	remove()
+	remove() // safe to call multiple times
+	startTransaction("drop", 0)
+	tracer.Flush(nil)
+
+	payloads := r.Payloads()
+	require.Len(t, payloads, 2)
+	transactions := payloads[0].Transactions()
+	require.Len(t, transactions, 2)
+	assert.Equal(t, "keep0", transactions[0].Name)
+	assert.Equal(t, "filtered", transactions[0].Result)
+	assert.Len(t, transactions[0].Spans, 1)
+	assert.Equal(t, "keep1", transactions[1].Name)
+	assert.Equal(t, "filtered", transactions[1].Result)
+	require.Len(t, transactions[1].Spans, 3)
+	for _, span := range transactions[1].Spans {
+		assert.Equal(t, "keep1", span.Name)
+		assert.NotEmpty(t, span.Stacktrace)
+	}
+
+	transactions = payloads[1].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "drop", transactions[0].Name)
+	assert.Equal(t, "", transactions[0].Result)
+
+	stats := tracer.Stats()
+	assert.Equal(t, uint64(1), stats.TransactionsFiltered)
+	assert.Equal(t, uint64(3), stats.TransactionsSent)
+}
@@ -48,7 +48,8 @@ func StartSpan(ctx context.Context, name, spanType string) (*Span, context.Conte
 // CaptureError returns a new Error related to the sampled transaction
 // present in the context, if any, and calls its SetException method
 // with the given error. The Error.Handled field will be set to true,
-// and a stacktrace set.
+// and a stacktrace set. If the context also holds a non-dropped span,
+// the Error.Span field will be set to it.
 //
 // If there is no transaction in the context, or it is not being sampled,
 // CaptureError returns nil. As a convenience, if the provided error is
@@ -64,6 +65,9 @@ func CaptureError(ctx context.Context, err error) *Error {
 	e := tx.tracer.NewError(err)
 	e.Handled = true
 	e.Transaction = tx
+	if span := SpanFromContext(ctx); span != nil && !span.Dropped() {
+		e.Span = span
+	}
 	return e
 }
 
@@ -0,0 +1,72 @@
+package elasticapm
+
+import (
+	"context"
+	"time"
+)
+
+// goroutinePanicFlushTimeout is the maximum amount of time to wait
+// for the tracer to flush a panic recovered by a wrapped goroutine,
+// before re-panicking.
+const goroutinePanicFlushTimeout = 10 * time.Second
+
+// Go calls fn in a new goroutine, passing it a context that carries
+// over the transaction and span from ctx. Panics in fn are reported
+// to the Elastic APM server before the goroutine re-panics.
+//
+// The tracer used to report panics is the tracer of the transaction
+// in ctx, if any, or DefaultTracer otherwise. See Tracer.WrapGoroutine
+// for more details.
+func Go(ctx context.Context, fn func(context.Context)) {
+	tracer := DefaultTracer
+	if tx := TransactionFromContext(ctx); tx != nil && tx.tracer != nil {
+		tracer = tx.tracer
+	}
+	go tracer.WrapGoroutine(ctx, fn)()
+}
+
+// WrapGoroutine returns a function which calls fn with a context
+// carrying over the transaction and span from ctx, and which is
+// intended to be called in a new goroutine, e.g.
+//
+//	go tracer.WrapGoroutine(ctx, fn)()
+//
+// The context passed to fn does not inherit ctx's deadline,
+// cancelation, or other values, so that fn may outlive the
+// operation that started it.
+//
+// If fn panics, the panic is recovered and reported as an unhandled
+// error with t.Recovered, associated with the transaction and span
+// in ctx, if any. The tracer is then flushed, waiting for a bounded
+// amount of time, and the goroutine re-panics with the original value.
+// If ctx holds a transaction, it must not be ended before fn returns.
+func (t *Tracer) WrapGoroutine(ctx context.Context, fn func(context.Context)) func() {
+	tx := TransactionFromContext(ctx)
+	span := SpanFromContext(ctx)
+	return func() {
+		ctx := context.Background()
+		if tx != nil {
+			ctx = ContextWithTransaction(ctx, tx)
+		}
+		if span != nil {
+			ctx = ContextWithSpan(ctx, span)
+		}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			e := t.Recovered(v, tx)
+			if span != nil && !span.Dropped() {
+				e.Span = span
+			}
+			e.Send()
+			abort := make(chan struct{})
+			timer := time.AfterFunc(goroutinePanicFlushTimeout, func() { close(abort) })
+			t.Flush(abort)
+			timer.Stop()
+			panic(v)
+		}()
+		fn(ctx)
+	}
+}
@@ -0,0 +1,60 @@
+package elasticapm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestWrapGoroutine(t *testing.T) {
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	txID := tx.ID()
+	span := tx.StartSpan("span", "type", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = elasticapm.ContextWithTransaction(ctx, tx)
+	ctx = elasticapm.ContextWithSpan(ctx, span)
+	cancel()
+
+	fn := tracer.WrapGoroutine(ctx, func(ctx context.Context) {
+		assert.NoError(t, ctx.Err())
+		assert.Equal(t, tx, elasticapm.TransactionFromContext(ctx))
+		assert.Equal(t, span, elasticapm.SpanFromContext(ctx))
+		panic("boom")
+	})
+	assert.PanicsWithValue(t, "boom", fn)
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := r.Payloads()
+	require.NotEmpty(t, payloads)
+	errors := payloads[0].Errors()
+	require.Len(t, errors, 1)
+	assert.Equal(t, "boom", errors[0].Exception.Message)
+	assert.False(t, errors[0].Exception.Handled)
+	assert.Equal(t, txID, errors[0].Transaction.ID)
+	require.NotNil(t, errors[0].ParentID)
+	assert.Equal(t, int64(0), *errors[0].ParentID)
+}
+
+func TestWrapGoroutineNoPanic(t *testing.T) {
+	tracer, r := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var called bool
+	tracer.WrapGoroutine(context.Background(), func(ctx context.Context) {
+		called = true
+		assert.Nil(t, elasticapm.TransactionFromContext(ctx))
+	})()
+	tracer.Flush(nil)
+	assert.True(t, called)
+	assert.Empty(t, r.Payloads())
+}
@@ -0,0 +1,41 @@
+package apmredisutil
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/apm-agent-go/internal/apmstrings"
+)
+
+// maxStatementLength is the maximum length of a span
+// statement, in runes.
+const maxStatementLength = 1024
+
+// FormatStatement returns a sanitized span statement for the Redis
+// command with the given name and arguments. The statement contains
+// the upper-cased command name and its first argument, which is
+// usually a key; all other arguments are replaced by "?". The
+// arguments of AUTH commands are all replaced.
+func FormatStatement(commandName string, args []interface{}) string {
+	if commandName == "" {
+		return ""
+	}
+	commandName = strings.ToUpper(commandName)
+	var buf bytes.Buffer
+	buf.WriteString(commandName)
+	for i, arg := range args {
+		buf.WriteByte(' ')
+		if i > 0 || commandName == "AUTH" {
+			buf.WriteByte('?')
+			continue
+		}
+		fmt.Fprint(&buf, arg)
+	}
+	return Truncate(buf.String())
+}
+
+// Truncate truncates statement to the maximum statement length.
+func Truncate(statement string) string {
+	return apmstrings.Truncate(statement, maxStatementLength)
+}
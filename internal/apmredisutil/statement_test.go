@@ -0,0 +1,28 @@
+package apmredisutil_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go/internal/apmredisutil"
+)
+
+func TestFormatStatement(t *testing.T) {
+	test := func(expect, commandName string, args ...interface{}) {
+		assert.Equal(t, expect, apmredisutil.FormatStatement(commandName, args))
+	}
+	test("", "")
+	test("PING", "ping")
+	test("GET key", "get", "key")
+	test("SET key ?", "SET", "key", "secret")
+	test("HSET hash ? ?", "hset", "hash", "field", 123)
+	test("EXPIRE 123 ?", "expire", 123, 10)
+	test("AUTH ?", "auth", "password")
+}
+
+func TestFormatStatementTruncated(t *testing.T) {
+	statement := apmredisutil.FormatStatement("get", []interface{}{strings.Repeat("k", 2000)})
+	assert.Len(t, statement, 1024)
+}
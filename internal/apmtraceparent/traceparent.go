@@ -0,0 +1,108 @@
+// Package apmtraceparent provides support for propagating the
+// transaction and span which are the parent of an operation in
+// another process, e.g. through message headers.
+package apmtraceparent
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// Header is the name of the header in which
+// a formatted TraceParent is propagated.
+const Header = "Elastic-Apm-Traceparent"
+
+// TraceParent identifies a transaction, and optionally
+// a span within it, which is the parent of an operation.
+type TraceParent struct {
+	// TransactionID holds the ID of the parent transaction.
+	TransactionID model.UUID
+
+	// SpanID holds the ID of the parent span, or -1
+	// if the parent is the transaction itself.
+	SpanID int64
+
+	// Sampled indicates whether the parent
+	// transaction is sampled.
+	Sampled bool
+}
+
+// FromContext returns a TraceParent identifying the transaction and
+// span in ctx. If ctx does not contain a transaction, FromContext
+// returns false.
+func FromContext(ctx context.Context) (TraceParent, bool) {
+	tx := elasticapm.TransactionFromContext(ctx)
+	if tx == nil {
+		return TraceParent{}, false
+	}
+	p := TraceParent{TransactionID: tx.ID(), SpanID: -1, Sampled: tx.Sampled()}
+	if span := elasticapm.SpanFromContext(ctx); span != nil && !span.Dropped() {
+		p.SpanID = span.ID()
+	}
+	return p, true
+}
+
+// String returns p formatted in the style of a W3C Trace Context
+// "traceparent" header: version, transaction ID, span ID, and flags,
+// separated by dashes, e.g.
+//
+//     00-0af7651916cd43dd8448eb211c80319c-0000000000000001-01
+//
+// If p has no parent span, the span ID is formatted as zeroes.
+func (p TraceParent) String() string {
+	var spanID [8]byte
+	if p.SpanID >= 0 {
+		// Offset by one so that a zero span ID
+		// indicates the absence of a parent span.
+		binary.BigEndian.PutUint64(spanID[:], uint64(p.SpanID)+1)
+	}
+	flags := "00"
+	if p.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(p.TransactionID[:]) + "-" + hex.EncodeToString(spanID[:]) + "-" + flags
+}
+
+// Parse parses s, formatted as described for TraceParent.String.
+func Parse(s string) (TraceParent, error) {
+	if len(s) != 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return TraceParent{}, errors.Errorf("invalid trace parent %q", s)
+	}
+	if s[:2] != "00" {
+		return TraceParent{}, errors.Errorf("unsupported trace parent version %q", s[:2])
+	}
+	var p TraceParent
+	if _, err := hex.Decode(p.TransactionID[:], []byte(s[3:35])); err != nil {
+		return TraceParent{}, errors.Wrap(err, "invalid transaction ID")
+	}
+	spanID, err := strconv.ParseUint(s[36:52], 16, 64)
+	if err != nil {
+		return TraceParent{}, errors.Wrap(err, "invalid span ID")
+	}
+	p.SpanID = int64(spanID) - 1
+	flags, err := strconv.ParseUint(s[53:55], 16, 8)
+	if err != nil {
+		return TraceParent{}, errors.Wrap(err, "invalid flags")
+	}
+	p.Sampled = flags&1 == 1
+	return p, nil
+}
+
+// SetTransactionParent records p in the custom context
+// of tx, under the key "parent".
+func SetTransactionParent(tx *elasticapm.Transaction, p TraceParent) {
+	parent := map[string]interface{}{
+		"transaction_id": p.TransactionID.String(),
+	}
+	if p.SpanID >= 0 {
+		parent["span_id"] = p.SpanID
+	}
+	tx.Context.SetCustom("parent", parent)
+}
@@ -0,0 +1,86 @@
+package apmtraceparent_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestFormatParse(t *testing.T) {
+	p := apmtraceparent.TraceParent{
+		TransactionID: model.UUID{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c},
+		SpanID:        0,
+		Sampled:       true,
+	}
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-0000000000000001-01", p.String())
+	parsed, err := apmtraceparent.Parse(p.String())
+	require.NoError(t, err)
+	assert.Equal(t, p, parsed)
+
+	p.SpanID = -1
+	p.Sampled = false
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-0000000000000000-00", p.String())
+	parsed, err = apmtraceparent.Parse(p.String())
+	require.NoError(t, err)
+	assert.Equal(t, p, parsed)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-0000000000000001",
+		"01-0af7651916cd43dd8448eb211c80319c-0000000000000001-01",
+		"00-0af7651916cd43dd8448eb211c80319z-0000000000000001-01",
+		"00-0af7651916cd43dd8448eb211c80319c-000000000000000z-01",
+		"00-0af7651916cd43dd8448eb211c80319c-0000000000000001-zz",
+	} {
+		_, err := apmtraceparent.Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	_, ok := apmtraceparent.FromContext(context.Background())
+	assert.False(t, ok)
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	txID := tx.ID()
+	p, ok := apmtraceparent.FromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, apmtraceparent.TraceParent{TransactionID: txID, SpanID: -1, Sampled: true}, p)
+
+	tx.StartSpan("first", "type", nil).End()
+	span, ctx := elasticapm.StartSpan(ctx, "second", "type")
+	p, ok = apmtraceparent.FromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, int64(1), p.SpanID)
+	span.End()
+
+	child := tracer.StartTransaction("child", "type")
+	apmtraceparent.SetTransactionParent(child, p)
+	child.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 2)
+	assert.Equal(t, model.IfaceMap{{
+		Key: "parent",
+		Value: map[string]interface{}{
+			"span_id":        float64(1),
+			"transaction_id": txID.String(),
+		},
+	}}, transactions[0].Context.Custom)
+	assert.Equal(t, *transactions[1].Spans[1].ID, p.SpanID)
+}
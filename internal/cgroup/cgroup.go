@@ -0,0 +1,284 @@
+// Package cgroup provides functions for reading the cgroup (v1 or v2)
+// memory and CPU controller statistics of the current process.
+package cgroup
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unlimitedMemoryThreshold is the threshold above which a cgroup v1
+// memory limit is considered unlimited. The kernel reports an unset
+// limit as the maximum int64 value rounded down to the page size.
+const unlimitedMemoryThreshold = 1 << 62
+
+// ErrNotFound is returned by NewReader if the process's
+// cgroup memory and CPU controllers cannot be found.
+var ErrNotFound = errors.New("cgroup controllers not found")
+
+// Stats holds cgroup memory and CPU controller statistics.
+type Stats struct {
+	// MemoryLimit holds the memory limit in bytes,
+	// or zero if memory is unlimited.
+	MemoryLimit uint64
+
+	// MemoryUsage holds the memory usage in bytes.
+	MemoryUsage uint64
+
+	// CPUQuota holds the CPU time available to the cgroup in
+	// each CPUPeriod, or zero if CPU time is unlimited.
+	CPUQuota time.Duration
+
+	// CPUPeriod holds the CPU quota enforcement period.
+	CPUPeriod time.Duration
+
+	// CPUPeriods holds the number of enforcement periods elapsed.
+	CPUPeriods uint64
+
+	// CPUThrottledPeriods holds the number of enforcement periods
+	// in which the cgroup was throttled.
+	CPUThrottledPeriods uint64
+
+	// CPUThrottledTime holds the total time for which the
+	// cgroup has been throttled.
+	CPUThrottledTime time.Duration
+}
+
+// Reader reads cgroup statistics for a process.
+type Reader struct {
+	v2        bool
+	memoryDir string
+	cpuDir    string
+}
+
+// NewReader returns a new Reader for the process whose procfs directory
+// is procDir (e.g. "/proc/self"), with the cgroup filesystem mounted at
+// cgroupRoot (e.g. "/sys/fs/cgroup"). If the process's memory and CPU
+// controllers cannot be found, NewReader returns ErrNotFound.
+func NewReader(procDir, cgroupRoot string) (*Reader, error) {
+	paths, err := readProcCgroup(filepath.Join(procDir, "cgroup"))
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{}
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err == nil {
+		// cgroup v2 ("unified") hierarchy.
+		path, ok := paths[""]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		dir := findDir(cgroupRoot, path, "memory.current")
+		if dir == "" {
+			return nil, ErrNotFound
+		}
+		r.v2 = true
+		r.memoryDir = dir
+		r.cpuDir = dir
+		return r, nil
+	}
+	for controllers, path := range paths {
+		for _, controller := range strings.Split(controllers, ",") {
+			switch controller {
+			case "memory":
+				r.memoryDir = findDir(filepath.Join(cgroupRoot, controllers), path, "memory.usage_in_bytes")
+				if r.memoryDir == "" {
+					r.memoryDir = findDir(filepath.Join(cgroupRoot, "memory"), path, "memory.usage_in_bytes")
+				}
+			case "cpu":
+				r.cpuDir = findDir(filepath.Join(cgroupRoot, controllers), path, "cpu.stat")
+				if r.cpuDir == "" {
+					r.cpuDir = findDir(filepath.Join(cgroupRoot, "cpu"), path, "cpu.stat")
+				}
+			}
+		}
+	}
+	if r.memoryDir == "" && r.cpuDir == "" {
+		return nil, ErrNotFound
+	}
+	return r, nil
+}
+
+// Read reads the current cgroup statistics.
+func (r *Reader) Read() (Stats, error) {
+	var stats Stats
+	if r.v2 {
+		return stats, r.readV2(&stats)
+	}
+	return stats, r.readV1(&stats)
+}
+
+func (r *Reader) readV1(stats *Stats) error {
+	if r.memoryDir != "" {
+		limit, err := readUint(filepath.Join(r.memoryDir, "memory.limit_in_bytes"))
+		if err != nil {
+			return err
+		}
+		if limit < unlimitedMemoryThreshold {
+			stats.MemoryLimit = limit
+		}
+		if stats.MemoryUsage, err = readUint(filepath.Join(r.memoryDir, "memory.usage_in_bytes")); err != nil {
+			return err
+		}
+	}
+	if r.cpuDir != "" {
+		quota, err := readInt(filepath.Join(r.cpuDir, "cpu.cfs_quota_us"))
+		if err != nil {
+			return err
+		}
+		if quota > 0 {
+			stats.CPUQuota = time.Duration(quota) * time.Microsecond
+		}
+		period, err := readUint(filepath.Join(r.cpuDir, "cpu.cfs_period_us"))
+		if err != nil {
+			return err
+		}
+		stats.CPUPeriod = time.Duration(period) * time.Microsecond
+
+		fields, err := readFields(filepath.Join(r.cpuDir, "cpu.stat"))
+		if err != nil {
+			return err
+		}
+		stats.CPUPeriods = fields["nr_periods"]
+		stats.CPUThrottledPeriods = fields["nr_throttled"]
+		stats.CPUThrottledTime = time.Duration(fields["throttled_time"])
+	}
+	return nil
+}
+
+func (r *Reader) readV2(stats *Stats) error {
+	limit, err := readFile(filepath.Join(r.memoryDir, "memory.max"))
+	if err != nil {
+		return err
+	}
+	if limit != "max" {
+		if stats.MemoryLimit, err = strconv.ParseUint(limit, 10, 64); err != nil {
+			return err
+		}
+	}
+	if stats.MemoryUsage, err = readUint(filepath.Join(r.memoryDir, "memory.current")); err != nil {
+		return err
+	}
+
+	// cpu.max holds "$MAX $PERIOD", where $MAX may be "max".
+	// The file does not exist if the cpu controller is not
+	// enabled for the cgroup.
+	cpuMax, err := readFile(filepath.Join(r.cpuDir, "cpu.max"))
+	if err == nil {
+		fields := strings.Fields(cpuMax)
+		if len(fields) != 2 {
+			return errors.New("failed to parse cpu.max")
+		}
+		if fields[0] != "max" {
+			quota, err := strconv.ParseUint(fields[0], 10, 64)
+			if err != nil {
+				return err
+			}
+			stats.CPUQuota = time.Duration(quota) * time.Microsecond
+		}
+		period, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		stats.CPUPeriod = time.Duration(period) * time.Microsecond
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	fields, err := readFields(filepath.Join(r.cpuDir, "cpu.stat"))
+	if err != nil {
+		return err
+	}
+	stats.CPUPeriods = fields["nr_periods"]
+	stats.CPUThrottledPeriods = fields["nr_throttled"]
+	stats.CPUThrottledTime = time.Duration(fields["throttled_usec"]) * time.Microsecond
+	return nil
+}
+
+// readProcCgroup parses /proc/<pid>/cgroup, returning a map of
+// comma-separated controller lists to cgroup paths. The cgroup v2
+// hierarchy has an empty controller list.
+func readProcCgroup(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	paths := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		paths[fields[1]] = fields[2]
+	}
+	return paths, scanner.Err()
+}
+
+// findDir returns the directory within the cgroup hierarchy mounted at
+// root containing the named file, trying first the cgroup path within
+// the hierarchy, and then the hierarchy's root. The latter is necessary
+// when the process is in a container with a private view of the cgroup
+// filesystem, but not a private cgroup namespace. If neither directory
+// contains the file, findDir returns "".
+func findDir(root, path, name string) string {
+	for _, dir := range []string{filepath.Join(root, path), root} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// readFields reads a file containing "key value" lines,
+// such as cpu.stat, returning a map of keys to values.
+func readFields(path string) (map[string]uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		kv := strings.Fields(line)
+		if len(kv) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		fields[kv[0]] = v
+	}
+	return fields, nil
+}
+
+func readFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func readUint(path string) (uint64, error) {
+	s, err := readFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func readInt(path string) (int64, error) {
+	s, err := readFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
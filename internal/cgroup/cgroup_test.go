@@ -0,0 +1,61 @@
+package cgroup_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/internal/cgroup"
+)
+
+func TestReaderV1(t *testing.T) {
+	stats := readTestdata(t, "v1")
+	assert.Equal(t, cgroup.Stats{
+		MemoryLimit:         536870912,
+		MemoryUsage:         104857600,
+		CPUQuota:            50 * time.Millisecond,
+		CPUPeriod:           100 * time.Millisecond,
+		CPUPeriods:          120,
+		CPUThrottledPeriods: 30,
+		CPUThrottledTime:    1500 * time.Millisecond,
+	}, stats)
+}
+
+func TestReaderV1Unlimited(t *testing.T) {
+	stats := readTestdata(t, "v1-unlimited")
+	assert.Equal(t, cgroup.Stats{
+		MemoryUsage: 4096,
+		CPUPeriod:   100 * time.Millisecond,
+	}, stats)
+}
+
+func TestReaderV2(t *testing.T) {
+	stats := readTestdata(t, "v2")
+	assert.Equal(t, cgroup.Stats{
+		MemoryLimit:         268435456,
+		MemoryUsage:         1048576,
+		CPUQuota:            200 * time.Millisecond,
+		CPUPeriod:           100 * time.Millisecond,
+		CPUPeriods:          10,
+		CPUThrottledPeriods: 2,
+		CPUThrottledTime:    5 * time.Millisecond,
+	}, stats)
+}
+
+func TestReaderNotFound(t *testing.T) {
+	dir := filepath.Join("testdata", "none")
+	_, err := cgroup.NewReader(filepath.Join(dir, "proc"), filepath.Join(dir, "sys"))
+	assert.Equal(t, cgroup.ErrNotFound, err)
+}
+
+func readTestdata(t *testing.T, name string) cgroup.Stats {
+	dir := filepath.Join("testdata", name)
+	r, err := cgroup.NewReader(filepath.Join(dir, "proc"), filepath.Join(dir, "sys"))
+	require.NoError(t, err)
+	stats, err := r.Read()
+	require.NoError(t, err)
+	return stats
+}
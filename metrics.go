@@ -1,7 +1,9 @@
 package elasticapm
 
 import (
+	"bytes"
 	"context"
+	"math"
 	"sort"
 	"strings"
 	"sync"
@@ -13,10 +15,78 @@ import (
 type Metrics struct {
 	mu      sync.Mutex
 	metrics []*model.Metrics
+
+	// index maps encoded labels to the corresponding
+	// element of metrics.
+	index map[string]*model.Metrics
+
+	// nameLabelSets holds the number of distinct label
+	// sets with a sample for each metric name, and
+	// labelSets holds the total number of distinct label
+	// sets, excluding the unlabeled and overflow sets.
+	nameLabelSets map[string]int
+	labelSets     int
+
+	// maxLabelSets and maxLabelSetsPerName limit the number of
+	// distinct label sets, in total and per metric name. Samples
+	// exceeding the limits are collapsed into the overflow label
+	// set, and counted in overflowed. Non-positive values mean
+	// there is no limit.
+	maxLabelSets        int
+	maxLabelSetsPerName int
+	overflowed          int
 }
 
+const (
+	// defaultMaxMetricLabelSets is the default maximum
+	// number of distinct metric label sets gathered.
+	defaultMaxMetricLabelSets = 1000
+
+	// defaultMaxMetricLabelSetsPerName is the default maximum
+	// number of distinct label sets gathered for each metric
+	// name.
+	defaultMaxMetricLabelSetsPerName = 100
+
+	// overflowedMetricsName is the name of the gauge reporting
+	// the number of samples collapsed into the overflow label
+	// set during gathering.
+	overflowedMetricsName = "elasticapm.metrics.overflowed"
+)
+
+// overflowMetricLabels is the label set into which samples
+// exceeding the label set limits are collapsed.
+var overflowMetricLabels = []MetricLabel{{Name: "_other", Value: "true"}}
+
 func (m *Metrics) reset() {
 	m.metrics = m.metrics[:0]
+	m.index = nil
+	m.nameLabelSets = nil
+	m.labelSets = 0
+	m.overflowed = 0
+}
+
+// setLimits sets the maximum number of distinct label sets,
+// in total and per metric name.
+func (m *Metrics) setLimits(maxLabelSets, maxLabelSetsPerName int) {
+	m.mu.Lock()
+	m.maxLabelSets = maxLabelSets
+	m.maxLabelSetsPerName = maxLabelSetsPerName
+	m.mu.Unlock()
+}
+
+// finish is called once all metrics have been gathered. It reports
+// the number of overflowed samples, and sorts the metrics by labels.
+func (m *Metrics) finish() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	overflowed := float64(m.overflowed)
+	m.getMetrics(nil, "").Samples[overflowedMetricsName] = model.Metric{
+		Type:  "gauge",
+		Value: &overflowed,
+	}
+	sort.Slice(m.metrics, func(i, j int) bool {
+		return compareLabels(m.metrics[i].Labels, m.metrics[j].Labels) < 0
+	})
 }
 
 // MetricLabel is a name/value pair for labeling metrics.
@@ -53,6 +123,21 @@ type SummaryMetric struct {
 	Quantiles map[float64]float64
 }
 
+// HistogramMetric holds a histogram of metric values.
+type HistogramMetric struct {
+	// Count is the count of values.
+	Count uint64
+
+	// Sum is the sum of values.
+	Sum float64
+
+	// Buckets holds the cumulative count of values less than or
+	// equal to each bucket's upper bound, keyed by upper bound.
+	// A bucket with an infinite upper bound is implied by Count,
+	// and is not reported.
+	Buckets map[float64]uint64
+}
+
 // MetricsGatherer provides an interface for gathering metrics.
 type MetricsGatherer interface {
 	// GatherMetrics gathers metrics and adds them to m.
@@ -65,6 +150,19 @@ type MetricsGatherer interface {
 	GatherMetrics(ctx context.Context, m *Metrics) error
 }
 
+// deltaMetricsGatherer is implemented by MetricsGatherers which report
+// some metrics as deltas since they were previously gathered. Each
+// consumer of the metrics must gather them from its own instance, so
+// that gathering by one consumer does not affect the deltas reported
+// to another.
+type deltaMetricsGatherer interface {
+	MetricsGatherer
+
+	// newConsumer returns a new MetricsGatherer which gathers the
+	// same metrics as the receiver, with its own delta state.
+	newConsumer() MetricsGatherer
+}
+
 // GatherMetricsFunc is a function type implementing MetricsGatherer.
 type GatherMetricsFunc func(context.Context, *Metrics) error
 
@@ -121,45 +219,162 @@ func (m *Metrics) AddSummary(name, unit string, labels []MetricLabel, summary Su
 	})
 }
 
+// AddHistogram adds a histogram metric with the given name, optional unit and
+// labels, and values. The labels are expected to be sorted lexicographically.
+func (m *Metrics) AddHistogram(name, unit string, labels []MetricLabel, histogram HistogramMetric) {
+	var buckets []model.HistogramBucket
+	if len(histogram.Buckets) > 0 {
+		buckets = make([]model.HistogramBucket, 0, len(histogram.Buckets))
+		for upperBound, count := range histogram.Buckets {
+			if math.IsInf(upperBound, 0) || math.IsNaN(upperBound) {
+				continue
+			}
+			buckets = append(buckets, model.HistogramBucket{
+				UpperBound: upperBound,
+				Count:      count,
+			})
+		}
+		sort.Slice(buckets, func(i, j int) bool {
+			return buckets[i].UpperBound < buckets[j].UpperBound
+		})
+	}
+	m.addMetric(name, labels, model.Metric{
+		Type:    "histogram",
+		Unit:    unit,
+		Count:   &histogram.Count,
+		Sum:     &histogram.Sum,
+		Buckets: buckets,
+	})
+}
+
 func (m *Metrics) addMetric(name string, labels []MetricLabel, metric model.Metric) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	var metrics *model.Metrics
-	results := make([]int, len(m.metrics))
-	i := sort.Search(len(m.metrics), func(j int) bool {
-		results[j] = compareLabels(m.metrics[j].Labels, labels)
-		return results[j] >= 0
-	})
-	if i < len(results) && results[i] == 0 {
-		// labels are equal
-		metrics = m.metrics[i]
-	} else {
-		var modelLabels model.StringMap
-		if len(labels) > 0 {
-			modelLabels = make(model.StringMap, len(labels))
-			for i, l := range labels {
-				modelLabels[i] = model.StringMapItem{
-					Key: l.Name, Value: l.Value,
-				}
-			}
+	key := encodeMetricLabels(labels)
+	metrics := m.index[key]
+	if metrics != nil {
+		if _, ok := metrics.Samples[name]; ok {
+			metrics.Samples[name] = metric
+			return
 		}
-		metrics = &model.Metrics{
-			Labels:  modelLabels,
-			Samples: make(map[string]model.Metric),
+	}
+	if len(labels) > 0 && m.overflows(name, metrics == nil) {
+		m.overflowed++
+		metrics = m.getMetrics(overflowMetricLabels, encodeMetricLabels(overflowMetricLabels))
+		if existing, ok := metrics.Samples[name]; ok {
+			metric = mergeOverflowedMetric(existing, metric)
 		}
-		if i == len(results) {
-			m.metrics = append(m.metrics, metrics)
-		} else {
-			m.metrics = append(m.metrics, nil)
-			copy(m.metrics[i+1:], m.metrics[i:])
-			m.metrics[i] = metrics
+		metrics.Samples[name] = metric
+		return
+	}
+	if metrics == nil {
+		metrics = m.getMetrics(labels, key)
+		if len(labels) > 0 {
+			m.labelSets++
 		}
 	}
+	if m.nameLabelSets == nil {
+		m.nameLabelSets = make(map[string]int)
+	}
+	m.nameLabelSets[name]++
 	metrics.Samples[name] = metric
 }
 
-func compareLabels(a model.StringMap, b []MetricLabel) int {
+// overflows reports whether adding a sample with the given name to
+// a labeled set, which is new if newLabelSet is true, would exceed
+// the label set limits.
+func (m *Metrics) overflows(name string, newLabelSet bool) bool {
+	if newLabelSet && m.maxLabelSets > 0 && m.labelSets >= m.maxLabelSets {
+		return true
+	}
+	return m.maxLabelSetsPerName > 0 && m.nameLabelSets[name] >= m.maxLabelSetsPerName
+}
+
+// getMetrics returns the model.Metrics with the given labels and
+// encoded key, creating it if it does not already exist.
+func (m *Metrics) getMetrics(labels []MetricLabel, key string) *model.Metrics {
+	if metrics, ok := m.index[key]; ok {
+		return metrics
+	}
+	var modelLabels model.StringMap
+	if len(labels) > 0 {
+		modelLabels = make(model.StringMap, len(labels))
+		for i, l := range labels {
+			modelLabels[i] = model.StringMapItem{
+				Key: l.Name, Value: l.Value,
+			}
+		}
+	}
+	metrics := &model.Metrics{
+		Labels:  modelLabels,
+		Samples: make(map[string]model.Metric),
+	}
+	if m.index == nil {
+		m.index = make(map[string]*model.Metrics)
+	}
+	m.index[key] = metrics
+	m.metrics = append(m.metrics, metrics)
+	return metrics
+}
+
+// mergeOverflowedMetric returns the result of collapsing two samples
+// with the same name into one. Counter and gauge values are summed,
+// as are the counts and sums of summaries and histograms. Histogram
+// buckets are summed if their upper bounds match, and are otherwise
+// dropped; all other statistics are dropped. If the samples have
+// different types, the newer sample replaces the existing one.
+func mergeOverflowedMetric(existing, metric model.Metric) model.Metric {
+	if existing.Type != metric.Type {
+		return metric
+	}
+	merged := model.Metric{Type: metric.Type, Unit: metric.Unit}
+	if existing.Value != nil && metric.Value != nil {
+		value := *existing.Value + *metric.Value
+		merged.Value = &value
+	}
+	if existing.Count != nil && metric.Count != nil {
+		count := *existing.Count + *metric.Count
+		merged.Count = &count
+	}
+	if existing.Sum != nil && metric.Sum != nil {
+		sum := *existing.Sum + *metric.Sum
+		merged.Sum = &sum
+	}
+	if len(existing.Buckets) == len(metric.Buckets) && len(metric.Buckets) > 0 {
+		buckets := make([]model.HistogramBucket, len(metric.Buckets))
+		for i, b := range metric.Buckets {
+			if existing.Buckets[i].UpperBound != b.UpperBound {
+				buckets = nil
+				break
+			}
+			buckets[i] = model.HistogramBucket{
+				UpperBound: b.UpperBound,
+				Count:      existing.Buckets[i].Count + b.Count,
+			}
+		}
+		merged.Buckets = buckets
+	}
+	return merged
+}
+
+// encodeMetricLabels returns a string uniquely
+// identifying the sorted labels.
+func encodeMetricLabels(labels []MetricLabel) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	for _, l := range labels {
+		buf.WriteString(l.Name)
+		buf.WriteByte(0)
+		buf.WriteString(l.Value)
+		buf.WriteByte(0)
+	}
+	return buf.String()
+}
+
+func compareLabels(a, b model.StringMap) int {
 	na, nb := len(a), len(b)
 	n := na
 	if na > nb {
@@ -167,7 +382,7 @@ func compareLabels(a model.StringMap, b []MetricLabel) int {
 	}
 	for i := 0; i < n; i++ {
 		la, lb := a[i], b[i]
-		d := strings.Compare(la.Key, lb.Name)
+		d := strings.Compare(la.Key, lb.Key)
 		if d == 0 {
 			d = strings.Compare(la.Value, lb.Value)
 		}
@@ -0,0 +1,266 @@
+package elasticapm
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elastic/apm-agent-go/model"
+)
+
+// MetricsHandler returns an http.Handler which gathers metrics from
+// all of the tracer's registered metrics gatherers on demand, and
+// renders them in the Prometheus text exposition format. This includes
+// the builtin metrics, such as the tracer's statistics.
+//
+// Metric names are converted to valid Prometheus metric names by
+// replacing invalid characters with underscores, e.g. "go.goroutines"
+// becomes "go_goroutines". The minimum, maximum, and standard deviation
+// of summary metrics are not rendered.
+//
+// Metrics reported as deltas, such as the GC pause quantiles, describe
+// the changes since the handler last gathered metrics, independently
+// of the tracer's periodic gathering and of any other handlers. The
+// exception is the delta counters and timers of the tracer's metrics
+// registry, which are rendered with their cumulative values, as
+// Prometheus requires counters to increase monotonically.
+func (t *Tracer) MetricsHandler() http.Handler {
+	return &metricsHandler{tracer: t}
+}
+
+var errTracerClosed = errors.New("tracer closed")
+
+type metricsHandler struct {
+	tracer *Tracer
+
+	mu sync.Mutex
+	// gatherers holds the handler's own instances of the
+	// tracer's delta metrics gatherers, keyed by the tracer's.
+	gatherers map[MetricsGatherer]MetricsGatherer
+}
+
+// ServeHTTP gathers and renders metrics.
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var m Metrics
+	if err := h.tracer.gatherMetrics(req.Context(), &m, h.consumerGatherer); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	writePrometheusMetrics(bw, m.metrics)
+	bw.Flush()
+}
+
+// consumerGatherer returns the handler's own instance of g if g is a
+// deltaMetricsGatherer, creating it on first use, and otherwise g.
+// This must be called with h.mu held.
+func (h *metricsHandler) consumerGatherer(g MetricsGatherer) MetricsGatherer {
+	dg, ok := g.(deltaMetricsGatherer)
+	if !ok {
+		return g
+	}
+	consumer, ok := h.gatherers[g]
+	if !ok {
+		if h.gatherers == nil {
+			h.gatherers = make(map[MetricsGatherer]MetricsGatherer)
+		}
+		consumer = dg.newConsumer()
+		h.gatherers[g] = consumer
+	}
+	return consumer
+}
+
+// gatherMetrics gathers metrics from each of the tracer's registered
+// metrics gatherers into m, independently of periodic gathering. Each
+// gatherer is passed to consumerGatherer, and metrics are gathered
+// from the MetricsGatherer it returns.
+func (t *Tracer) gatherMetrics(
+	ctx context.Context, m *Metrics,
+	consumerGatherer func(MetricsGatherer) MetricsGatherer,
+) error {
+	type gatherers struct {
+		gatherers           []MetricsGatherer
+		logger              Logger
+		maxLabelSets        int
+		maxLabelSetsPerName int
+	}
+	result := make(chan gatherers, 1)
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		result <- gatherers{
+			gatherers:           append([]MetricsGatherer(nil), cfg.metricsGatherers...),
+			logger:              cfg.logger,
+			maxLabelSets:        cfg.maxMetricLabelSets,
+			maxLabelSetsPerName: cfg.maxMetricLabelSetsPerName,
+		}
+	})
+	var g gatherers
+	select {
+	case g = <-result:
+	case <-t.closed:
+		return errTracerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	m.setLimits(g.maxLabelSets, g.maxLabelSetsPerName)
+	for _, gatherer := range g.gatherers {
+		gatherMetrics(ctx, consumerGatherer(gatherer), m, g.logger)
+	}
+	m.finish()
+	return nil
+}
+
+type prometheusFamily struct {
+	typ     string
+	metrics []prometheusMetric
+}
+
+type prometheusMetric struct {
+	labels model.StringMap
+	metric model.Metric
+}
+
+// writePrometheusMetrics writes metrics to w in the Prometheus text
+// exposition format, grouping samples with the same name into metric
+// families, in order of name.
+func writePrometheusMetrics(w *bufio.Writer, metrics []*model.Metrics) {
+	families := make(map[string]*prometheusFamily)
+	for _, m := range metrics {
+		for name, metric := range m.Samples {
+			name = prometheusName(name)
+			family, ok := families[name]
+			if !ok {
+				family = &prometheusFamily{typ: metric.Type}
+				families[name] = family
+			} else if family.typ != metric.Type {
+				// Prometheus requires all metrics
+				// in a family to have the same type.
+				continue
+			}
+			family.metrics = append(family.metrics, prometheusMetric{
+				labels: m.Labels,
+				metric: metric,
+			})
+		}
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := families[name]
+		switch family.typ {
+		case "counter", "gauge", "summary", "histogram":
+			w.WriteString("# TYPE " + name + " " + family.typ + "\n")
+		default:
+			w.WriteString("# TYPE " + name + " untyped\n")
+		}
+		for _, m := range family.metrics {
+			switch family.typ {
+			case "summary":
+				for _, q := range m.metric.Quantiles {
+					writePrometheusSample(w, name, m.labels, "quantile", formatPrometheusFloat(q.Quantile), q.Value)
+				}
+				writePrometheusSummaryTotals(w, name, m)
+			case "histogram":
+				for _, b := range m.metric.Buckets {
+					writePrometheusSample(w, name+"_bucket", m.labels, "le", formatPrometheusFloat(b.UpperBound), float64(b.Count))
+				}
+				var count uint64
+				if m.metric.Count != nil {
+					count = *m.metric.Count
+				}
+				writePrometheusSample(w, name+"_bucket", m.labels, "le", "+Inf", float64(count))
+				writePrometheusSummaryTotals(w, name, m)
+			default:
+				if m.metric.Value != nil {
+					writePrometheusSample(w, name, m.labels, "", "", *m.metric.Value)
+				}
+			}
+		}
+	}
+}
+
+func writePrometheusSummaryTotals(w *bufio.Writer, name string, m prometheusMetric) {
+	if m.metric.Sum != nil {
+		writePrometheusSample(w, name+"_sum", m.labels, "", "", *m.metric.Sum)
+	}
+	if m.metric.Count != nil {
+		writePrometheusSample(w, name+"_count", m.labels, "", "", float64(*m.metric.Count))
+	}
+}
+
+// writePrometheusSample writes a single sample line, with an optional
+// extra label (e.g. "quantile" or "le") following the metric labels.
+func writePrometheusSample(
+	w *bufio.Writer, name string, labels model.StringMap,
+	extraLabel, extraLabelValue string, value float64,
+) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writePrometheusLabel(w, prometheusName(l.Key), l.Value)
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			writePrometheusLabel(w, extraLabel, extraLabelValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatPrometheusFloat(value))
+	w.WriteByte('\n')
+}
+
+func writePrometheusLabel(w *bufio.Writer, name, value string) {
+	w.WriteString(name)
+	w.WriteString(`="`)
+	w.WriteString(prometheusLabelValueReplacer.Replace(value))
+	w.WriteByte('"')
+}
+
+var prometheusLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusName returns name with all characters not valid
+// in a Prometheus metric name replaced by '_'.
+func prometheusName(name string) string {
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		// Metric names must not begin with a digit.
+		name = "_" + name
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func formatPrometheusFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,154 @@
+package elasticapm_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.RegisterMetricsGatherer(elasticapm.GatherMetricsFunc(
+		func(ctx context.Context, m *elasticapm.Metrics) error {
+			m.AddCounter("http.requests", "", []elasticapm.MetricLabel{
+				{Name: "path", Value: `/"quoted"`},
+			}, 3)
+			m.AddCounter("http.requests", "", []elasticapm.MetricLabel{
+				{Name: "path", Value: "/"},
+			}, 4)
+			m.AddSummary("latency", "sec", nil, elasticapm.SummaryMetric{
+				Count:     2,
+				Sum:       1.5,
+				Quantiles: map[float64]float64{0.5: 0.5, 0.99: 1},
+			})
+			m.AddHistogram("size", "byte", nil, elasticapm.HistogramMetric{
+				Count:   3,
+				Sum:     300,
+				Buckets: map[float64]uint64{100: 1, 200: 2},
+			})
+			return nil
+		},
+	))
+	tracer.NewError(errors.New("boom")).Send()
+	tracer.Flush(nil)
+
+	server := httptest.NewServer(tracer.MetricsHandler())
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	text := string(body)
+
+	assertContains := func(s string) {
+		assert.True(t, strings.Contains(text, s), "%q not found in:\n%s", s, text)
+	}
+	assertContains("# TYPE http_requests counter\nhttp_requests{path=\"/\"} 4\nhttp_requests{path=\"/\\\"quoted\\\"\"} 3\n")
+	assertContains("# TYPE latency summary\nlatency{quantile=\"0.5\"} 0.5\nlatency{quantile=\"0.99\"} 1\nlatency_sum 1.5\nlatency_count 2\n")
+	assertContains("# TYPE size histogram\nsize_bucket{le=\"100\"} 1\nsize_bucket{le=\"200\"} 2\nsize_bucket{le=\"+Inf\"} 3\nsize_sum 300\nsize_count 3\n")
+	assertContains("# TYPE go_goroutines gauge\n")
+	assertContains("# TYPE elasticapm_errors_sent counter\nelasticapm_errors_sent 1\n")
+}
+
+func TestMetricsHandlerTracerClosed(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	tracer.Close()
+
+	w := httptest.NewRecorder()
+	tracer.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestMetricsHandlerDeltas(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	handler := tracer.MetricsHandler()
+
+	tracer.SendMetrics(nil)
+	runtime.GC()
+	runtime.GC()
+
+	// Gathering metrics for the handler must not affect
+	// the deltas reported by the tracer's periodic gathering.
+	scrapeMetrics(t, handler)
+	scrapeMetrics(t, handler)
+	tracer.SendMetrics(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	samples := payloads[1].Metrics()[0].Samples
+	assert.Condition(t, func() bool {
+		return *samples["go.mem.gc.count"].Value >= 2
+	}, "value: %v", *samples["go.mem.gc.count"].Value)
+}
+
+func TestMetricsHandlerRegistryDeltas(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	handler := tracer.MetricsHandler()
+
+	counter := tracer.Metrics().DeltaCounter("requests")
+	timer := tracer.Metrics().DeltaTimer("latency")
+	counter.Add(2)
+	timer.Update(time.Second)
+	scrapeMetrics(t, handler)
+	counter.Add(3)
+	timer.Update(2 * time.Second)
+	tracer.SendMetrics(nil)
+
+	// Prometheus requires counters to increase monotonically,
+	// so delta counters and timers are rendered cumulatively.
+	text := scrapeMetrics(t, handler)
+	assert.Contains(t, text, "# TYPE requests counter\nrequests 5\n")
+	assert.Contains(t, text, "# TYPE latency summary\nlatency_sum 3\nlatency_count 2\n")
+}
+
+func scrapeMetrics(t *testing.T, h http.Handler) string {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMetricsHandlerDeltasPerHandler(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	handler1 := tracer.MetricsHandler()
+	handler2 := tracer.MetricsHandler()
+
+	scrapeMetrics(t, handler1)
+	scrapeMetrics(t, handler2)
+	runtime.GC()
+	runtime.GC()
+
+	// Each handler reports the GCs since it last gathered
+	// metrics, regardless of gathering by the other.
+	for _, h := range []http.Handler{handler1, handler2} {
+		text := scrapeMetrics(t, h)
+		i := strings.Index(text, "\ngo_mem_gc_count ")
+		require.NotEqual(t, -1, i, "go_mem_gc_count not found in:\n%s", text)
+		line := text[i+1:]
+		line = line[:strings.IndexByte(line, '\n')]
+		count, err := strconv.ParseFloat(strings.TrimPrefix(line, "go_mem_gc_count "), 64)
+		require.NoError(t, err)
+		assert.Condition(t, func() bool { return count >= 2 }, "value: %v", count)
+	}
+}
@@ -0,0 +1,359 @@
+package elasticapm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MetricsRegistry holds counters, gauges, and timers which are
+// updated by the application, and gathered by the tracer along
+// with the builtin metrics.
+//
+// Counters and timers are cumulative by default: their values
+// accumulate for the lifetime of the process, and are not reset when
+// gathered. This allows rates to be derived from the values,
+// regardless of how often they are gathered. Counters and timers
+// created with DeltaCounter and DeltaTimer instead report the change
+// since metrics were last gathered. Gauges hold the most recently
+// set value.
+type MetricsRegistry struct {
+	mu       sync.Mutex
+	counters map[metricKey]*Counter
+	gauges   map[metricKey]*Gauge
+	timers   map[metricKey]*Timer
+
+	// last holds the values of delta counters and timers
+	// when they were last gathered by the tracer.
+	last metricsRegistryDeltas
+}
+
+// metricsRegistryDeltas holds the values of a registry's delta
+// counters and timers when they were last gathered by a consumer.
+type metricsRegistryDeltas struct {
+	counters map[*Counter]float64
+	timers   map[*Timer]timerValue
+}
+
+type timerValue struct {
+	count uint64
+	sum   time.Duration
+}
+
+type metricKey struct {
+	name   string
+	labels string
+}
+
+func newMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		counters: make(map[metricKey]*Counter),
+		gauges:   make(map[metricKey]*Gauge),
+		timers:   make(map[metricKey]*Timer),
+	}
+}
+
+// Metrics returns the tracer's MetricsRegistry, which may be used
+// for recording application metrics.
+func (t *Tracer) Metrics() *MetricsRegistry {
+	return t.metricsRegistry
+}
+
+// Counter returns the cumulative Counter with the given name and
+// labels, creating it if it does not already exist. Counter panics
+// if the counter exists, and was created with DeltaCounter.
+func (r *MetricsRegistry) Counter(name string, labels ...MetricLabel) *Counter {
+	return r.counter(name, labels, false)
+}
+
+// DeltaCounter returns the delta Counter with the given name and
+// labels, creating it if it does not already exist. Each time metrics
+// are gathered, the counter reports the amount it has been increased
+// by since they were last gathered. DeltaCounter panics if the counter
+// exists, and was created with Counter.
+func (r *MetricsRegistry) DeltaCounter(name string, labels ...MetricLabel) *Counter {
+	return r.counter(name, labels, true)
+}
+
+func (r *MetricsRegistry) counter(name string, labels []MetricLabel, delta bool) *Counter {
+	labels, key := makeMetricKey(name, labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.counters[key]
+	if !ok {
+		c = &Counter{name: name, labels: labels, delta: delta}
+		r.counters[key] = c
+	} else if c.delta != delta {
+		panic(fmt.Sprintf("counter %q already exists with a different mode", name))
+	}
+	return c
+}
+
+// Gauge returns the Gauge with the given name and labels,
+// creating it if it does not already exist.
+func (r *MetricsRegistry) Gauge(name string, labels ...MetricLabel) *Gauge {
+	labels, key := makeMetricKey(name, labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	g, ok := r.gauges[key]
+	if !ok {
+		g = &Gauge{name: name, labels: labels}
+		r.gauges[key] = g
+	}
+	return g
+}
+
+// Timer returns the cumulative Timer with the given name and labels,
+// creating it if it does not already exist. Timer panics if the timer
+// exists, and was created with DeltaTimer.
+func (r *MetricsRegistry) Timer(name string, labels ...MetricLabel) *Timer {
+	return r.timer(name, labels, false)
+}
+
+// DeltaTimer returns the delta Timer with the given name and labels,
+// creating it if it does not already exist. Each time metrics are
+// gathered, the timer reports the count and total duration of the
+// operations recorded since they were last gathered. DeltaTimer panics
+// if the timer exists, and was created with Timer.
+func (r *MetricsRegistry) DeltaTimer(name string, labels ...MetricLabel) *Timer {
+	return r.timer(name, labels, true)
+}
+
+func (r *MetricsRegistry) timer(name string, labels []MetricLabel, delta bool) *Timer {
+	labels, key := makeMetricKey(name, labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.timers[key]
+	if !ok {
+		t = &Timer{name: name, labels: labels, delta: delta}
+		r.timers[key] = t
+	} else if t.delta != delta {
+		panic(fmt.Sprintf("timer %q already exists with a different mode", name))
+	}
+	return t
+}
+
+// Unregister removes the counter, gauge, and timer with the given
+// name and labels from the registry, so they are no longer gathered.
+// Subsequent calls to Counter, Gauge, or Timer with the same name and
+// labels will create new metrics.
+func (r *MetricsRegistry) Unregister(name string, labels ...MetricLabel) {
+	_, key := makeMetricKey(name, labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.counters, key)
+	delete(r.gauges, key)
+	delete(r.timers, key)
+}
+
+// GatherMetrics gathers the registry's metrics into m.
+func (r *MetricsRegistry) GatherMetrics(ctx context.Context, m *Metrics) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gatherMetrics(m, &r.last)
+	return nil
+}
+
+// newConsumer returns a MetricsGatherer which gathers the
+// registry's metrics, reporting the cumulative values of delta
+// counters and timers. Consumers such as Prometheus expect counters
+// and summary totals to increase monotonically, and compute the
+// rate of change themselves.
+func (r *MetricsRegistry) newConsumer() MetricsGatherer {
+	return &metricsRegistryConsumer{registry: r}
+}
+
+type metricsRegistryConsumer struct {
+	registry *MetricsRegistry
+}
+
+// GatherMetrics gathers the registry's metrics into m.
+func (c *metricsRegistryConsumer) GatherMetrics(ctx context.Context, m *Metrics) error {
+	c.registry.mu.Lock()
+	defer c.registry.mu.Unlock()
+	c.registry.gatherMetrics(m, nil)
+	return nil
+}
+
+// gatherMetrics gathers the registry's metrics into m, reporting
+// the change in delta counters and timers since the values recorded
+// in last, and then updating last. If last is nil, the cumulative
+// values are reported. This must be called with r.mu held.
+//
+// Metrics are gathered in order of name and labels, so that the same
+// series are retained each time if the label set limits are exceeded.
+func (r *MetricsRegistry) gatherMetrics(m *Metrics, last *metricsRegistryDeltas) {
+	var next metricsRegistryDeltas
+	keys := make([]metricKey, 0, len(r.counters)+len(r.gauges)+len(r.timers))
+	for key := range r.counters {
+		keys = append(keys, key)
+	}
+	sortMetricKeys(keys)
+	for _, key := range keys {
+		c := r.counters[key]
+		value := c.Value()
+		if c.delta && last != nil {
+			if next.counters == nil {
+				next.counters = make(map[*Counter]float64)
+			}
+			next.counters[c] = value
+			value -= last.counters[c]
+		}
+		m.AddCounter(c.name, "", c.labels, value)
+	}
+	keys = keys[:0]
+	for key := range r.gauges {
+		keys = append(keys, key)
+	}
+	sortMetricKeys(keys)
+	for _, key := range keys {
+		g := r.gauges[key]
+		m.AddGauge(g.name, "", g.labels, g.Value())
+	}
+	keys = keys[:0]
+	for key := range r.timers {
+		keys = append(keys, key)
+	}
+	sortMetricKeys(keys)
+	for _, key := range keys {
+		t := r.timers[key]
+		t.mu.Lock()
+		value := timerValue{count: t.count, sum: t.sum}
+		t.mu.Unlock()
+		if t.delta && last != nil {
+			if next.timers == nil {
+				next.timers = make(map[*Timer]timerValue)
+			}
+			next.timers[t] = value
+			prev := last.timers[t]
+			value.count -= prev.count
+			value.sum -= prev.sum
+		}
+		m.AddSummary(t.name, "sec", t.labels, SummaryMetric{
+			Count: value.count,
+			Sum:   value.sum.Seconds(),
+		})
+	}
+	if last != nil {
+		// Replacing last discards the values of unregistered metrics.
+		*last = next
+	}
+}
+
+// sortMetricKeys sorts keys by name, and then by labels.
+func sortMetricKeys(keys []metricKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].labels < keys[j].labels
+	})
+}
+
+// makeMetricKey returns a sorted copy of labels, and
+// a key uniquely identifying the name and labels.
+func makeMetricKey(name string, labels []MetricLabel) ([]MetricLabel, metricKey) {
+	if len(labels) == 0 {
+		return nil, metricKey{name: name}
+	}
+	labels = append([]MetricLabel(nil), labels...)
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels, metricKey{name: name, labels: encodeMetricLabels(labels)}
+}
+
+// Counter is a metric whose value only increases. Counters are
+// cumulative, unless created with MetricsRegistry.DeltaCounter.
+type Counter struct {
+	name   string
+	labels []MetricLabel
+	delta  bool
+
+	mu    sync.Mutex
+	value float64
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds delta to the counter. Add will panic
+// if delta is negative.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("counter cannot decrease in value")
+	}
+	c.mu.Lock()
+	c.value += delta
+	c.mu.Unlock()
+}
+
+// Value returns the current value of the counter. For delta
+// counters, this is the total for the lifetime of the counter.
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// Gauge is a metric whose value may arbitrarily increase
+// or decrease.
+type Gauge struct {
+	name   string
+	labels []MetricLabel
+
+	mu    sync.Mutex
+	value float64
+}
+
+// Set sets the gauge's value.
+func (g *Gauge) Set(value float64) {
+	g.mu.Lock()
+	g.value = value
+	g.mu.Unlock()
+}
+
+// Add adds delta, which may be negative, to the gauge's value.
+func (g *Gauge) Add(delta float64) {
+	g.mu.Lock()
+	g.value += delta
+	g.mu.Unlock()
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+// Timer is a metric recording the count and total duration of timed
+// operations. Timers are reported as summary metrics, in seconds.
+// Timers are cumulative, unless created with MetricsRegistry.DeltaTimer.
+type Timer struct {
+	name   string
+	labels []MetricLabel
+	delta  bool
+
+	mu    sync.Mutex
+	count uint64
+	sum   time.Duration
+}
+
+// Update records an operation with the given duration.
+func (t *Timer) Update(d time.Duration) {
+	t.mu.Lock()
+	t.count++
+	t.sum += d
+	t.mu.Unlock()
+}
+
+// UpdateSince records an operation which started at
+// the given time, and has just completed.
+func (t *Timer) UpdateSince(start time.Time) {
+	t.Update(time.Since(start))
+}
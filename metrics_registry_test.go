@@ -0,0 +1,187 @@
+package elasticapm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	registry := tracer.Metrics()
+	orders := registry.Counter("orders", elasticapm.MetricLabel{Name: "region", Value: "eu"})
+	orders.Inc()
+	orders.Add(2)
+	assert.Panics(t, func() { orders.Add(-1) })
+
+	// Labels are order-insensitive.
+	registry.Counter("payments",
+		elasticapm.MetricLabel{Name: "region", Value: "eu"},
+		elasticapm.MetricLabel{Name: "currency", Value: "EUR"},
+	).Inc()
+	registry.Counter("payments",
+		elasticapm.MetricLabel{Name: "currency", Value: "EUR"},
+		elasticapm.MetricLabel{Name: "region", Value: "eu"},
+	).Inc()
+
+	queue := registry.Gauge("queue.length")
+	queue.Set(10)
+	queue.Add(-3)
+
+	timer := registry.Timer("checkout")
+	timer.Update(100 * time.Millisecond)
+	timer.Update(200 * time.Millisecond)
+
+	tracer.SendMetrics(nil)
+	orders.Inc()
+	tracer.SendMetrics(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	for i, p := range payloads {
+		metrics := p.Metrics()
+		require.Len(t, metrics, 3)
+
+		assert.Nil(t, metrics[0].Labels)
+		assert.Equal(t, model.Metric{Type: "gauge", Value: newFloat64(7)}, metrics[0].Samples["queue.length"])
+		assert.Equal(t, model.Metric{
+			Type:  "summary",
+			Unit:  "sec",
+			Count: newUint64(2),
+			Sum:   newFloat64(0.3),
+		}, metrics[0].Samples["checkout"])
+
+		assert.Equal(t, model.StringMap{
+			{Key: "currency", Value: "EUR"},
+			{Key: "region", Value: "eu"},
+		}, metrics[1].Labels)
+		assert.Equal(t, map[string]model.Metric{
+			"payments": {Type: "counter", Value: newFloat64(2)},
+		}, metrics[1].Samples)
+
+		// Counters are cumulative, and not reset when gathered.
+		assert.Equal(t, model.StringMap{{Key: "region", Value: "eu"}}, metrics[2].Labels)
+		assert.Equal(t, map[string]model.Metric{
+			"orders": {Type: "counter", Value: newFloat64(float64(3 + i))},
+		}, metrics[2].Samples)
+	}
+}
+
+func TestMetricsRegistryDelta(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	registry := tracer.Metrics()
+	cumulative := registry.Counter("cumulative")
+	delta := registry.DeltaCounter("delta")
+	cumulativeTimer := registry.Timer("cumulative.timer")
+	deltaTimer := registry.DeltaTimer("delta.timer")
+	assert.Panics(t, func() { registry.Counter("delta") })
+	assert.Panics(t, func() { registry.DeltaTimer("cumulative.timer") })
+
+	cumulative.Add(2)
+	delta.Add(2)
+	cumulativeTimer.Update(time.Second)
+	deltaTimer.Update(time.Second)
+	tracer.SendMetrics(nil)
+
+	cumulative.Add(3)
+	delta.Add(3)
+	cumulativeTimer.Update(2 * time.Second)
+	deltaTimer.Update(2 * time.Second)
+	deltaTimer.Update(2 * time.Second)
+
+	// Gathering by the metrics handler does not
+	// affect the deltas gathered by the tracer.
+	scrapeMetrics(t, tracer.MetricsHandler())
+	tracer.SendMetrics(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	first := payloads[0].Metrics()[0].Samples
+	second := payloads[1].Metrics()[0].Samples
+
+	assert.Equal(t, newFloat64(2), first["cumulative"].Value)
+	assert.Equal(t, newFloat64(5), second["cumulative"].Value)
+	assert.Equal(t, newFloat64(2), first["delta"].Value)
+	assert.Equal(t, newFloat64(3), second["delta"].Value)
+	assert.Equal(t, float64(5), delta.Value())
+
+	assert.Equal(t, newUint64(1), first["cumulative.timer"].Count)
+	assert.Equal(t, newUint64(2), second["cumulative.timer"].Count)
+	assert.Equal(t, newFloat64(3), second["cumulative.timer"].Sum)
+	assert.Equal(t, newUint64(1), first["delta.timer"].Count)
+	assert.Equal(t, newUint64(2), second["delta.timer"].Count)
+	assert.Equal(t, newFloat64(4), second["delta.timer"].Sum)
+}
+
+func TestMetricsRegistryUnregister(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	registry := tracer.Metrics()
+	label := elasticapm.MetricLabel{Name: "region", Value: "eu"}
+	registry.Counter("orders", label).Inc()
+	registry.DeltaCounter("payments", label).Add(2)
+	registry.Gauge("queue.length").Set(1)
+	tracer.SendMetrics(nil)
+
+	registry.Unregister("orders", label)
+	registry.Unregister("payments", label)
+	registry.Unregister("queue.length")
+	registry.DeltaCounter("payments", label).Inc()
+	tracer.SendMetrics(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	for _, m := range payloads[1].Metrics() {
+		assert.NotContains(t, m.Samples, "orders")
+		assert.NotContains(t, m.Samples, "queue.length")
+	}
+
+	// A delta counter created after unregistering
+	// reports its own value, not the change from
+	// the unregistered counter's value.
+	metrics := payloads[1].Metrics()
+	labeled := metrics[len(metrics)-1]
+	assert.Equal(t, model.StringMap{{Key: "region", Value: "eu"}}, labeled.Labels)
+	assert.Equal(t, map[string]model.Metric{
+		"payments": {Type: "counter", Value: newFloat64(1)},
+	}, labeled.Samples)
+}
+
+func TestMetricsRegistryLabelSetLimits(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMaxMetricLabelSetsPerName(2)
+
+	registry := tracer.Metrics()
+	for _, user := range []string{"e", "d", "c", "b", "a"} {
+		registry.Counter("requests", elasticapm.MetricLabel{Name: "user", Value: user}).Inc()
+	}
+	for i := 0; i < 5; i++ {
+		tracer.SendMetrics(nil)
+	}
+
+	// The same series are retained each time
+	// metrics are gathered, in order of labels.
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 5)
+	for _, p := range payloads {
+		var users []string
+		for _, m := range p.Metrics() {
+			if _, ok := m.Samples["requests"]; ok {
+				users = append(users, m.Labels[0].Value)
+			}
+		}
+		assert.Equal(t, []string{"true", "a", "b"}, users)
+	}
+}
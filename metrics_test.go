@@ -2,7 +2,9 @@ package elasticapm_test
 
 import (
 	"context"
+	"math"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -17,6 +19,8 @@ func TestTracerMetricsBuiltin(t *testing.T) {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
 
+	// Force a GC, so the pause quantiles are reported.
+	runtime.GC()
 	tracer.SendMetrics(nil)
 
 	payloads := transport.Payloads()
@@ -81,8 +85,10 @@ func TestTracerMetricsBuiltin(t *testing.T) {
 		},
 	}
 
-	assert.Equal(t, map[string]model.Metric{
+	expected := map[string]model.Metric{
 		"go.goroutines": gaugeMetric(""),
+		"go.gomaxprocs": gaugeMetric(""),
+		"go.cgo.calls":  counterMetric(""),
 
 		"go.mem.heap.mallocs":       counterMetric(""),
 		"go.mem.heap.frees":         counterMetric(""),
@@ -99,11 +105,62 @@ func TestTracerMetricsBuiltin(t *testing.T) {
 
 		"elasticapm.transactions.sent":        counterMetric(""),
 		"elasticapm.transactions.dropped":     counterMetric(""),
+		"elasticapm.transactions.filtered":    counterMetric(""),
 		"elasticapm.transactions.send_errors": counterMetric(""),
 		"elasticapm.errors.sent":              counterMetric(""),
 		"elasticapm.errors.dropped":           counterMetric(""),
+		"elasticapm.errors.filtered":          counterMetric(""),
 		"elasticapm.errors.send_errors":       counterMetric(""),
-	}, builtinMetrics.Samples)
+		"elasticapm.metrics.overflowed":       gaugeMetric(""),
+	}
+	if runtime.GOOS == "linux" {
+		expected["system.cpu.total.pct"] = gaugeMetric("")
+		expected["system.memory.total"] = gaugeMetric("byte")
+		expected["system.memory.free"] = gaugeMetric("byte")
+		expected["system.process.cpu.total.pct"] = gaugeMetric("")
+		expected["system.process.memory.rss"] = gaugeMetric("byte")
+		expected["system.process.memory.size"] = gaugeMetric("byte")
+		expected["system.process.threads"] = gaugeMetric("")
+		expected["system.process.fd.open"] = gaugeMetric("")
+	}
+	for name := range builtinMetrics.Samples {
+		// cgroup metrics are only reported when running
+		// within a cgroup, which depends on the environment.
+		if strings.HasPrefix(name, "system.process.cgroup.") {
+			delete(builtinMetrics.Samples, name)
+		}
+	}
+	assert.Equal(t, expected, builtinMetrics.Samples)
+}
+
+func TestTracerMetricsBuiltinDeltas(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.SendMetrics(nil)
+	runtime.GC()
+	runtime.GC()
+	tracer.SendMetrics(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 2)
+	first := payloads[0].Metrics()[0].Samples
+	second := payloads[1].Metrics()[0].Samples
+
+	for _, name := range []string{"go.mem.gc.count", "go.mem.heap.alloc_rate", "go.goroutines.delta"} {
+		assert.NotContains(t, first, name)
+		assert.Contains(t, second, name)
+	}
+	assert.Equal(t, "byte/sec", second["go.mem.heap.alloc_rate"].Unit)
+	assert.Condition(t, func() bool {
+		return *second["go.mem.gc.count"].Value >= 2
+	}, "value: %v", *second["go.mem.gc.count"].Value)
+
+	// The pause summary describes the pauses
+	// since the previous gathering.
+	pause := second["go.mem.gc.pause"]
+	assert.Len(t, pause.Quantiles, 5)
+	assert.Equal(t, *second["go.mem.gc.count"].Value, float64(*pause.Count))
 }
 
 func TestTracerMetricsGatherer(t *testing.T) {
@@ -150,6 +207,47 @@ func TestTracerMetricsGatherer(t *testing.T) {
 	}, metrics[2].Samples)
 }
 
+func TestTracerMetricsHistogram(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.RegisterMetricsGatherer(elasticapm.GatherMetricsFunc(
+		func(ctx context.Context, m *elasticapm.Metrics) error {
+			m.AddHistogram("latency", "sec", []elasticapm.MetricLabel{
+				{Name: "path", Value: "/"},
+			}, elasticapm.HistogramMetric{
+				Count: 5,
+				Sum:   2.5,
+				Buckets: map[float64]uint64{
+					1:           4,
+					0.1:         1,
+					math.Inf(1): 5,
+				},
+			})
+			return nil
+		},
+	))
+	tracer.SendMetrics(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	metrics := payloads[0].Metrics()
+	require.Len(t, metrics, 2)
+
+	assert.Equal(t, map[string]model.Metric{
+		"latency": {
+			Type:  "histogram",
+			Unit:  "sec",
+			Count: newUint64(5),
+			Sum:   newFloat64(2.5),
+			Buckets: []model.HistogramBucket{
+				{UpperBound: 0.1, Count: 1},
+				{UpperBound: 1, Count: 4},
+			},
+		},
+	}, metrics[1].Samples)
+}
+
 func TestTracerMetricsDeregister(t *testing.T) {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
@@ -181,3 +279,53 @@ func newUint64(v uint64) *uint64 {
 func newFloat64(f float64) *float64 {
 	return &f
 }
+
+func TestTracerMetricsLabelSetLimits(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMaxMetricLabelSets(3)
+	tracer.SetMaxMetricLabelSetsPerName(2)
+
+	tracer.RegisterMetricsGatherer(elasticapm.GatherMetricsFunc(
+		func(ctx context.Context, m *elasticapm.Metrics) error {
+			for _, user := range []string{"a", "b", "c", "d"} {
+				m.AddCounter("requests", "", []elasticapm.MetricLabel{
+					{Name: "user", Value: user},
+				}, 1)
+			}
+			m.AddCounter("requests", "", []elasticapm.MetricLabel{
+				{Name: "user", Value: "a"},
+			}, 2) // existing label set, replaces the sample
+			m.AddGauge("size", "", []elasticapm.MetricLabel{
+				{Name: "queue", Value: "x"},
+			}, 10)
+			m.AddGauge("size", "", []elasticapm.MetricLabel{
+				{Name: "queue", Value: "y"},
+			}, 20) // exceeds total label set limit
+			return nil
+		},
+	))
+	tracer.SendMetrics(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	metrics := payloads[0].Metrics()
+	require.Len(t, metrics, 5)
+
+	assert.Nil(t, metrics[0].Labels)
+	assert.Equal(t, model.Metric{
+		Type:  "gauge",
+		Value: newFloat64(3),
+	}, metrics[0].Samples["elasticapm.metrics.overflowed"])
+
+	assert.Equal(t, model.StringMap{{Key: "_other", Value: "true"}}, metrics[1].Labels)
+	assert.Equal(t, map[string]model.Metric{
+		"requests": {Type: "counter", Value: newFloat64(2)},
+		"size":     {Type: "gauge", Value: newFloat64(20)},
+	}, metrics[1].Samples)
+
+	assert.Equal(t, model.StringMap{{Key: "queue", Value: "x"}}, metrics[2].Labels)
+	assert.Equal(t, model.StringMap{{Key: "user", Value: "a"}}, metrics[3].Labels)
+	assert.Equal(t, newFloat64(2), metrics[3].Samples["requests"].Value)
+	assert.Equal(t, model.StringMap{{Key: "user", Value: "b"}}, metrics[4].Labels)
+}
@@ -489,6 +489,26 @@ func (q *Quantile) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalFastJSON writes the JSON representation of b to w.
+func (b *HistogramBucket) MarshalFastJSON(w *fastjson.Writer) {
+	w.RawByte('[')
+	w.Float64(b.UpperBound)
+	w.RawByte(',')
+	w.Uint64(b.Count)
+	w.RawByte(']')
+}
+
+// UnmarshalJSON unmarshals the JSON data into b.
+func (b *HistogramBucket) UnmarshalJSON(data []byte) error {
+	var values []float64
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	b.UpperBound = values[0]
+	b.Count = uint64(values[1])
+	return nil
+}
+
 func (id *UUID) isZero() bool {
 	return *id == UUID{}
 }
@@ -526,6 +546,22 @@ func (id *UUID) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('"')
 }
 
+// String returns id in the canonical hex-encoded UUID format,
+// e.g. "01234567-89ab-cdef-0123-456789abcdef".
+func (id UUID) String() string {
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], id[:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], id[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], id[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], id[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], id[10:])
+	return string(buf)
+}
+
 func writeHex(w *fastjson.Writer, v []byte) {
 	const hextable = "0123456789abcdef"
 	for _, v := range v {
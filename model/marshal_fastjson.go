@@ -231,10 +231,41 @@ func (v *Span) MarshalFastJSON(w *fastjson.Writer) {
 
 func (v *SpanContext) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('{')
+	first := true
 	if v.Database != nil {
-		w.RawString("\"db\":")
+		const prefix = ",\"db\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
 		v.Database.MarshalFastJSON(w)
 	}
+	if v.Tags != nil {
+		const prefix = ",\"tags\":"
+		if first {
+			first = false
+			w.RawString(prefix[1:])
+		} else {
+			w.RawString(prefix)
+		}
+		w.RawByte('{')
+		{
+			first := true
+			for k, v := range v.Tags {
+				if first {
+					first = false
+				} else {
+					w.RawByte(',')
+				}
+				w.String(k)
+				w.RawByte(':')
+				w.String(v)
+			}
+		}
+		w.RawByte('}')
+	}
 	w.RawByte('}')
 }
 
@@ -414,6 +445,10 @@ func (v *Error) MarshalFastJSON(w *fastjson.Writer) {
 		w.RawString(",\"log\":")
 		v.Log.MarshalFastJSON(w)
 	}
+	if v.ParentID != nil {
+		w.RawString(",\"parent_id\":")
+		w.Int64(*v.ParentID)
+	}
 	if !v.Transaction.isZero() {
 		w.RawString(",\"transaction\":")
 		v.Transaction.MarshalFastJSON(w)
@@ -780,6 +815,17 @@ func (v *Metric) MarshalFastJSON(w *fastjson.Writer) {
 	w.RawByte('{')
 	w.RawString("\"type\":")
 	w.String(v.Type)
+	if v.Buckets != nil {
+		w.RawString(",\"buckets\":")
+		w.RawByte('[')
+		for i, v := range v.Buckets {
+			if i != 0 {
+				w.RawByte(',')
+			}
+			v.MarshalFastJSON(w)
+		}
+		w.RawByte(']')
+	}
 	if v.Count != nil {
 		w.RawString(",\"count\":")
 		w.Uint64(*v.Count)
@@ -97,6 +97,9 @@ func TestMarshalTransaction(t *testing.T) {
 						"type":      "sql",
 						"user":      "barb",
 					},
+					"tags": map[string]interface{}{
+						"region": "us-east-1",
+					},
 				},
 			},
 		},
@@ -146,6 +149,16 @@ func TestMarshalMetrics(t *testing.T) {
 					[]interface{}{float64(1.00), float64(100)},
 				},
 			},
+			"histogram_metric": map[string]interface{}{
+				"type":  "histogram",
+				"unit":  "sec",
+				"count": float64(5),
+				"sum":   float64(2.5),
+				"buckets": []interface{}{
+					[]interface{}{float64(0.1), float64(1)},
+					[]interface{}{float64(1), float64(4)},
+				},
+			},
 		},
 	}
 
@@ -248,6 +261,12 @@ func TestMarshalError(t *testing.T) {
 	w.Reset()
 	e.MarshalFastJSON(&w)
 	assert.Equal(t, `{"timestamp":"1970-01-01T00:02:03Z","transaction":{"id":"00010203-0405-0607-0809-0a0b0c0d0e0f"}}`, string(w.Bytes()))
+
+	parentID := int64(123)
+	e.ParentID = &parentID
+	w.Reset()
+	e.MarshalFastJSON(&w)
+	assert.Equal(t, `{"timestamp":"1970-01-01T00:02:03Z","parent_id":123,"transaction":{"id":"00010203-0405-0607-0809-0a0b0c0d0e0f"}}`, string(w.Bytes()))
 }
 
 func TestMarshalCookies(t *testing.T) {
@@ -495,6 +514,15 @@ func TestMarshalURL(t *testing.T) {
 	assert.Equal(t, in, out)
 }
 
+func TestUUIDString(t *testing.T) {
+	id := model.UUID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	assert.Equal(t, "00010203-0405-0607-0809-0a0b0c0d0e0f", id.String())
+
+	var w fastjson.Writer
+	id.MarshalFastJSON(&w)
+	assert.Equal(t, `"`+id.String()+`"`, string(w.Bytes()))
+}
+
 func TestUnmarshalJSON(t *testing.T) {
 	tp := fakeTransactionsPayload(1)
 	var w fastjson.Writer
@@ -579,6 +607,7 @@ func fakeTransaction() model.Transaction {
 					Type:      "sql",
 					User:      "barb",
 				},
+				Tags: map[string]string{"region": "us-east-1"},
 			},
 		}},
 	}
@@ -613,6 +642,16 @@ func fakeMetrics() *model.Metrics {
 					{Quantile: 1, Value: 100},
 				},
 			},
+			"histogram_metric": {
+				Type:  "histogram",
+				Unit:  "sec",
+				Count: newUint64(5),
+				Sum:   newFloat64(2.5),
+				Buckets: []model.HistogramBucket{
+					{UpperBound: 0.1, Count: 1},
+					{UpperBound: 1, Count: 4},
+				},
+			},
 		},
 	}
 }
@@ -188,6 +188,9 @@ type SpanContext struct {
 	// Database holds contextual information for database
 	// operation spans.
 	Database *DatabaseSpanContext `json:"db,omitempty"`
+
+	// Tags holds user-defined key/value pairs.
+	Tags map[string]string `json:"tags,omitempty"`
 }
 
 // DatabaseSpanContext holds contextual information for database
@@ -260,6 +263,11 @@ type Error struct {
 	// this error relates, if any.
 	Transaction ErrorTransaction `json:"transaction,omitempty"`
 
+	// ParentID holds the ID of the span within which the error
+	// occurred, if any. The span ID is unique only within the
+	// transaction identified by Transaction.
+	ParentID *int64 `json:"parent_id,omitempty"`
+
 	// Culprit holds the name of the function which
 	// produced the error.
 	Culprit string `json:"culprit,omitempty"`
@@ -507,7 +515,8 @@ type Metrics struct {
 
 // Metric holds metric values.
 type Metric struct {
-	// Type is the metric type: "counter", "gauge", or "summary".
+	// Type is the metric type: "counter", "gauge", "summary",
+	// or "histogram".
 	Type string `json:"type"`
 
 	// Unit holds the metric unit, e.g. "byte", or "sec".
@@ -516,10 +525,10 @@ type Metric struct {
 	// Value holds the value for gauge and counter metrics.
 	Value *float64 `json:"value,omitempty"`
 
-	// Count holds the count for summary metrics.
+	// Count holds the count for summary and histogram metrics.
 	Count *uint64 `json:"count,omitempty"`
 
-	// Sum holds the sum for summary metrics.
+	// Sum holds the sum for summary and histogram metrics.
 	Sum *float64 `json:"sum,omitempty"`
 
 	// Min holds the minimum value for summary metrics.
@@ -533,6 +542,20 @@ type Metric struct {
 
 	// Quantiles holds φ-quantiles for summary metrics.
 	Quantiles []Quantile `json:"quantiles,omitempty"`
+
+	// Buckets holds the buckets for histogram metrics,
+	// in order of increasing upper bound.
+	Buckets []HistogramBucket `json:"buckets,omitempty"`
+}
+
+// HistogramBucket represents a bucket for a histogram metric.
+type HistogramBucket struct {
+	// UpperBound holds the inclusive upper bound of the bucket.
+	UpperBound float64
+
+	// Count holds the cumulative count of values less than
+	// or equal to UpperBound.
+	Count uint64
 }
 
 // Quantile represents a φ-quantile for a summary metric.
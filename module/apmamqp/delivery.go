@@ -0,0 +1,181 @@
+package apmamqp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/streadway/amqp"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+)
+
+// Handler handles a single delivery. The context holds the
+// delivery's transaction.
+type Handler func(ctx context.Context, d amqp.Delivery) error
+
+// WrapHandler returns a function which calls h for a delivery,
+// reporting a transaction for it.
+//
+// Transactions are named after the queue, if specified with WithQueue,
+// or otherwise the delivery's routing key; e.g. "AMQP RECEIVE from queue".
+// If the delivery has a trace parent header, recorded by Publish, then
+// it is recorded in the transaction's custom context under "parent".
+//
+// If h acknowledges the delivery, the transaction's result records how:
+// "ack", "nack", or "requeue" if it was rejected and requeued. If h returns
+// an error, the error is reported to Elastic APM and returned; if h did not
+// acknowledge the delivery, the transaction's result is "error". If h
+// panics and recovery is not enabled, the transaction's result is "panic".
+//
+// By default, the handler will trace with elasticapm.DefaultTracer, and will
+// not recover any panics. Use WithTracer to specify an alternative tracer, and
+// WithRecovery to enable panic recovery.
+func WrapHandler(h Handler, o ...Option) func(amqp.Delivery) error {
+	opts := handlerOptions{tracer: elasticapm.DefaultTracer}
+	for _, o := range o {
+		o(&opts)
+	}
+	return func(d amqp.Delivery) (err error) {
+		ctx := context.Background()
+		if !opts.tracer.Active() {
+			return h(ctx, d)
+		}
+		name := opts.queue
+		if name == "" {
+			name = d.RoutingKey
+		}
+		tx := opts.tracer.StartTransaction("AMQP RECEIVE from "+name, "messaging")
+		ctx = elasticapm.ContextWithTransaction(ctx, tx)
+		defer tx.End()
+
+		if tx.Sampled() {
+			if opts.queue != "" {
+				tx.Context.SetTag("queue", opts.queue)
+			}
+			if d.Exchange != "" {
+				tx.Context.SetTag("exchange", d.Exchange)
+			}
+			tx.Context.SetTag("routing_key", d.RoutingKey)
+			if s, ok := d.Headers[apmtraceparent.Header].(string); ok {
+				if p, err := apmtraceparent.Parse(s); err == nil {
+					apmtraceparent.SetTransactionParent(tx, p)
+				}
+			}
+		}
+
+		// Record how the delivery is acknowledged, if at all.
+		ack := &acknowledger{Acknowledger: d.Acknowledger}
+		if d.Acknowledger != nil {
+			d.Acknowledger = ack
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				e := opts.tracer.Recovered(r, tx)
+				e.Handled = opts.recover
+				e.Send()
+				if !opts.recover {
+					tx.Result = "panic"
+					panic(r)
+				}
+				err = fmt.Errorf("%s", r)
+			}
+			tx.Result = ack.result()
+			if tx.Result == "" && err != nil {
+				tx.Result = "error"
+			}
+		}()
+
+		if err = h(ctx, d); err != nil {
+			if e := elasticapm.CaptureError(ctx, err); e != nil {
+				e.Send()
+			}
+		}
+		return err
+	}
+}
+
+// acknowledger wraps an amqp.Acknowledger,
+// recording how a delivery is acknowledged.
+type acknowledger struct {
+	amqp.Acknowledger
+	mu     sync.Mutex
+	action string
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.setResult("ack")
+	return a.Acknowledger.Ack(tag, multiple)
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.setRejected(requeue)
+	return a.Acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	a.setRejected(requeue)
+	return a.Acknowledger.Reject(tag, requeue)
+}
+
+func (a *acknowledger) setRejected(requeue bool) {
+	if requeue {
+		a.setResult("requeue")
+	} else {
+		a.setResult("nack")
+	}
+}
+
+func (a *acknowledger) setResult(action string) {
+	a.mu.Lock()
+	a.action = action
+	a.mu.Unlock()
+}
+
+func (a *acknowledger) result() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.action
+}
+
+type handlerOptions struct {
+	tracer  *elasticapm.Tracer
+	queue   string
+	recover bool
+}
+
+// Option sets options for the handler returned by WrapHandler.
+type Option func(*handlerOptions)
+
+// WithTracer returns an Option which sets t as the tracer
+// to use for tracing deliveries.
+func WithTracer(t *elasticapm.Tracer) Option {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(o *handlerOptions) {
+		o.tracer = t
+	}
+}
+
+// WithQueue returns an Option which sets the name of the queue
+// from which deliveries are consumed, for naming transactions.
+func WithQueue(name string) Option {
+	return func(o *handlerOptions) {
+		o.queue = name
+	}
+}
+
+// WithRecovery returns an Option which enables panic recovery
+// in the delivery handler.
+//
+// The handler will report panics as errors to Elastic APM, but
+// unless this is enabled, they will still cause the consumer to
+// be terminated. With recovery enabled, panics will be translated
+// to errors returned by the handler.
+func WithRecovery() Option {
+	return func(o *handlerOptions) {
+		o.recover = true
+	}
+}
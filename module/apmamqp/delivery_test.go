@@ -0,0 +1,148 @@
+package apmamqp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmamqp"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestWrapHandler(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	parent := apmtraceparent.TraceParent{
+		TransactionID: model.UUID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:        -1,
+		Sampled:       true,
+	}
+	handler := apmamqp.WrapHandler(func(ctx context.Context, d amqp.Delivery) error {
+		assert.NotNil(t, elasticapm.TransactionFromContext(ctx))
+		switch d.DeliveryTag {
+		case 1:
+			return d.Ack(false)
+		case 2:
+			d.Nack(false, true)
+			return errors.New("boom")
+		case 3:
+			return d.Reject(false)
+		}
+		return errors.New("unacknowledged")
+	}, apmamqp.WithTracer(tracer), apmamqp.WithQueue("queue"))
+
+	var ack acknowledger
+	assert.NoError(t, handler(amqp.Delivery{
+		Acknowledger: &ack,
+		DeliveryTag:  1,
+		Exchange:     "exchange",
+		RoutingKey:   "key",
+		Headers:      amqp.Table{apmtraceparent.Header: parent.String()},
+	}))
+	assert.EqualError(t, handler(amqp.Delivery{Acknowledger: &ack, DeliveryTag: 2}), "boom")
+	assert.NoError(t, handler(amqp.Delivery{Acknowledger: &ack, DeliveryTag: 3}))
+	assert.EqualError(t, handler(amqp.Delivery{Acknowledger: &ack, DeliveryTag: 4}), "unacknowledged")
+	assert.Equal(t, []string{"ack 1", "nack 2 true", "reject 3 false"}, ack.calls)
+	tracer.Flush(nil)
+
+	var transactions []model.Transaction
+	var errs []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			errs = append(errs, p.Errors()...)
+		}
+	}
+	require.Len(t, transactions, 4)
+	var results []string
+	for _, tx := range transactions {
+		assert.Equal(t, "AMQP RECEIVE from queue", tx.Name)
+		assert.Equal(t, "messaging", tx.Type)
+		results = append(results, tx.Result)
+	}
+	assert.Equal(t, []string{"ack", "requeue", "nack", "error"}, results)
+	assert.Equal(t, map[string]string{
+		"queue":       "queue",
+		"exchange":    "exchange",
+		"routing_key": "key",
+	}, transactions[0].Context.Tags)
+	assert.Equal(t, model.IfaceMap{{
+		Key: "parent",
+		Value: map[string]interface{}{
+			"transaction_id": parent.TransactionID.String(),
+		},
+	}}, transactions[0].Context.Custom)
+	assert.Len(t, errs, 2)
+}
+
+func TestWrapHandlerRoutingKey(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	handler := apmamqp.WrapHandler(func(ctx context.Context, d amqp.Delivery) error {
+		return nil
+	}, apmamqp.WithTracer(tracer))
+	assert.NoError(t, handler(amqp.Delivery{RoutingKey: "key"}))
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "AMQP RECEIVE from key", transactions[0].Name)
+	assert.Equal(t, "", transactions[0].Result)
+}
+
+func TestWrapHandlerPanic(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	handler := apmamqp.WrapHandler(func(ctx context.Context, d amqp.Delivery) error {
+		panic("boom")
+	}, apmamqp.WithTracer(tracer))
+	assert.Panics(t, func() { handler(amqp.Delivery{RoutingKey: "key"}) })
+	tracer.Flush(nil)
+
+	var transactions []model.Transaction
+	var errs []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			errs = append(errs, p.Errors()...)
+		}
+	}
+	require.Len(t, transactions, 1)
+	assert.Equal(t, "panic", transactions[0].Result)
+	require.Len(t, errs, 1)
+	assert.False(t, errs[0].Exception.Handled)
+}
+
+type acknowledger struct {
+	calls []string
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.calls = append(a.calls, fmt.Sprintf("ack %d", tag))
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.calls = append(a.calls, fmt.Sprintf("nack %d %t", tag, requeue))
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	a.calls = append(a.calls, fmt.Sprintf("reject %d %t", tag, requeue))
+	return nil
+}
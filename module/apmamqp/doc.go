@@ -0,0 +1,4 @@
+// Package apmamqp provides support for tracing AMQP publishers and
+// consumers using github.com/streadway/amqp, propagating the trace
+// parent through message headers.
+package apmamqp
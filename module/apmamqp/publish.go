@@ -0,0 +1,65 @@
+package apmamqp
+
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+)
+
+// Publisher is the interface for publishing messages,
+// implemented by *amqp.Channel.
+type Publisher interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// Publish publishes msg with ch.Publish, reporting a span if ctx contains
+// a sampled transaction, and recording the trace parent in msg's headers.
+//
+// Spans are named after the exchange, e.g. "AMQP PUBLISH to exchange",
+// or after the routing key if publishing to the default exchange.
+// Failures to publish are reported as errors.
+func Publish(
+	ctx context.Context, ch Publisher,
+	exchange, key string, mandatory, immediate bool,
+	msg amqp.Publishing,
+) error {
+	tx := elasticapm.TransactionFromContext(ctx)
+	if tx == nil || !tx.Sampled() {
+		return ch.Publish(exchange, key, mandatory, immediate, msg)
+	}
+
+	target := exchange
+	if target == "" {
+		target = key
+	}
+	span := tx.StartSpan("AMQP PUBLISH to "+target, "messaging.amqp.publish", elasticapm.SpanFromContext(ctx))
+	defer span.End()
+	if span.Dropped() {
+		return ch.Publish(exchange, key, mandatory, immediate, msg)
+	}
+	if exchange != "" {
+		span.Context.SetTag("exchange", exchange)
+	}
+	span.Context.SetTag("routing_key", key)
+
+	ctx = elasticapm.ContextWithSpan(ctx, span)
+	if p, ok := apmtraceparent.FromContext(ctx); ok {
+		// Copy the headers to avoid modifying the caller's table.
+		headers := make(amqp.Table, len(msg.Headers)+1)
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		headers[apmtraceparent.Header] = p.String()
+		msg.Headers = headers
+	}
+	err := ch.Publish(exchange, key, mandatory, immediate, msg)
+	if err != nil {
+		if e := elasticapm.CaptureError(ctx, err); e != nil {
+			e.Send()
+		}
+	}
+	return err
+}
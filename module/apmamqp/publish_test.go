@@ -0,0 +1,99 @@
+package apmamqp_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmamqp"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestPublish(t *testing.T) {
+	var ch publisher
+	headers := amqp.Table{"foo": "bar"}
+	tx, errs := withTransaction(t, func(ctx context.Context) {
+		err := apmamqp.Publish(ctx, &ch, "exchange", "key", false, false, amqp.Publishing{Headers: headers})
+		assert.NoError(t, err)
+		ch.err = errors.New("boom")
+		err = apmamqp.Publish(ctx, &ch, "", "queue", false, false, amqp.Publishing{})
+		assert.EqualError(t, err, "boom")
+	})
+	require.Len(t, tx.Spans, 2)
+	assert.Equal(t, "AMQP PUBLISH to exchange", tx.Spans[0].Name)
+	assert.Equal(t, "messaging.amqp.publish", tx.Spans[0].Type)
+	assert.Equal(t, &model.SpanContext{Tags: map[string]string{
+		"exchange":    "exchange",
+		"routing_key": "key",
+	}}, tx.Spans[0].Context)
+	assert.Equal(t, "AMQP PUBLISH to queue", tx.Spans[1].Name)
+	assert.Equal(t, &model.SpanContext{Tags: map[string]string{
+		"routing_key": "queue",
+	}}, tx.Spans[1].Context)
+
+	require.Len(t, ch.published, 2)
+	assert.Equal(t, "bar", ch.published[0].Headers["foo"])
+	assert.Len(t, headers, 1, "caller's headers should not be modified")
+	for i, msg := range ch.published {
+		p, err := apmtraceparent.Parse(msg.Headers[apmtraceparent.Header].(string))
+		require.NoError(t, err)
+		assert.Equal(t, apmtraceparent.TraceParent{
+			TransactionID: tx.ID,
+			SpanID:        *tx.Spans[i].ID,
+			Sampled:       true,
+		}, p)
+	}
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, "boom", errs[0].Exception.Message)
+	assert.Equal(t, tx.Spans[1].ID, errs[0].ParentID)
+}
+
+func TestPublishNoTransaction(t *testing.T) {
+	var ch publisher
+	err := apmamqp.Publish(context.Background(), &ch, "exchange", "key", false, false, amqp.Publishing{})
+	assert.NoError(t, err)
+	require.Len(t, ch.published, 1)
+	assert.Nil(t, ch.published[0].Headers)
+}
+
+type publisher struct {
+	published []amqp.Publishing
+	err       error
+}
+
+func (p *publisher) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	p.published = append(p.published, msg)
+	return p.err
+}
+
+func withTransaction(t *testing.T, f func(ctx context.Context)) (model.Transaction, []*model.Error) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	f(ctx)
+
+	tx.End()
+	tracer.Flush(nil)
+	var transactions []model.Transaction
+	var errors []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			errors = append(errors, p.Errors()...)
+		}
+	}
+	require.Len(t, transactions, 1)
+	return transactions[0], errors
+}
@@ -0,0 +1,3 @@
+// Package apmawssdk provides support for tracing requests made
+// with the AWS SDK for Go (github.com/aws/aws-sdk-go).
+package apmawssdk
@@ -0,0 +1,120 @@
+package apmawssdk
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+)
+
+// maxMessageAttributes is the maximum number of attributes
+// that SQS and SNS permit a message to have. If a message
+// already has this many, the trace parent is not injected.
+const maxMessageAttributes = 10
+
+// TraceParentAttribute is the name of the message attribute in which
+// the trace parent is propagated through SQS and SNS messages.
+const TraceParentAttribute = apmtraceparent.Header
+
+// withTraceParent returns a copy of the parameters of an SQS or SNS
+// publishing operation, with the trace parent identified by ctx added
+// to the message attributes, or a copy of the parameters of an SQS
+// ReceiveMessage operation, requesting the attribute be returned. If
+// the trace parent cannot be added, params is returned unmodified.
+//
+// params itself is never modified, so that it may safely be reused.
+func withTraceParent(ctx context.Context, params interface{}) interface{} {
+	p, ok := apmtraceparent.FromContext(ctx)
+	if !ok {
+		return params
+	}
+	value := p.String()
+	switch params := params.(type) {
+	case *sqs.SendMessageInput:
+		paramsCopy := *params
+		paramsCopy.MessageAttributes = withSQSAttribute(params.MessageAttributes, value)
+		return &paramsCopy
+	case *sqs.SendMessageBatchInput:
+		paramsCopy := *params
+		paramsCopy.Entries = make([]*sqs.SendMessageBatchRequestEntry, len(params.Entries))
+		for i, entry := range params.Entries {
+			if entry == nil {
+				continue
+			}
+			entryCopy := *entry
+			entryCopy.MessageAttributes = withSQSAttribute(entry.MessageAttributes, value)
+			paramsCopy.Entries[i] = &entryCopy
+		}
+		return &paramsCopy
+	case *sqs.ReceiveMessageInput:
+		for _, name := range params.MessageAttributeNames {
+			switch aws.StringValue(name) {
+			case "All", ".*", TraceParentAttribute:
+				return params
+			}
+		}
+		paramsCopy := *params
+		paramsCopy.MessageAttributeNames = make([]*string, len(params.MessageAttributeNames), len(params.MessageAttributeNames)+1)
+		copy(paramsCopy.MessageAttributeNames, params.MessageAttributeNames)
+		paramsCopy.MessageAttributeNames = append(paramsCopy.MessageAttributeNames, aws.String(TraceParentAttribute))
+		return &paramsCopy
+	case *sns.PublishInput:
+		if len(params.MessageAttributes) >= maxMessageAttributes {
+			return params
+		}
+		paramsCopy := *params
+		paramsCopy.MessageAttributes = make(map[string]*sns.MessageAttributeValue, len(params.MessageAttributes)+1)
+		for k, v := range params.MessageAttributes {
+			paramsCopy.MessageAttributes[k] = v
+		}
+		paramsCopy.MessageAttributes[TraceParentAttribute] = &sns.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+		return &paramsCopy
+	}
+	return params
+}
+
+// withSQSAttribute returns a copy of attrs with the trace parent
+// attribute added, or attrs if it already holds the maximum number
+// of attributes.
+func withSQSAttribute(attrs map[string]*sqs.MessageAttributeValue, value string) map[string]*sqs.MessageAttributeValue {
+	if len(attrs) >= maxMessageAttributes {
+		return attrs
+	}
+	attrsCopy := make(map[string]*sqs.MessageAttributeValue, len(attrs)+1)
+	for k, v := range attrs {
+		attrsCopy[k] = v
+	}
+	attrsCopy[TraceParentAttribute] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+	return attrsCopy
+}
+
+// SetTransactionParent records the trace parent propagated in msg's
+// attributes, if any, in the custom context of tx. This may be used
+// to link a transaction processing a message received from SQS with
+// the transaction that sent it. SetTransactionParent reports whether
+// msg contained a valid trace parent.
+//
+// ReceiveMessage requests made with a wrapped session will request
+// the trace parent attribute automatically.
+func SetTransactionParent(tx *elasticapm.Transaction, msg *sqs.Message) bool {
+	attr, ok := msg.MessageAttributes[TraceParentAttribute]
+	if !ok {
+		return false
+	}
+	p, err := apmtraceparent.Parse(aws.StringValue(attr.StringValue))
+	if err != nil {
+		return false
+	}
+	apmtraceparent.SetTransactionParent(tx, p)
+	return true
+}
@@ -0,0 +1,152 @@
+package apmawssdk
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+const handlerPrefix = "github.com/elastic/apm-agent-go/module/apmawssdk."
+
+// resourceFields maps the names of common request parameter
+// fields to the span tags in which their values are recorded.
+var resourceFields = []struct {
+	field, tag string
+	value      func(string) string
+}{
+	{field: "Bucket", tag: "bucket"},
+	{field: "TableName", tag: "table"},
+	{field: "QueueUrl", tag: "queue", value: queueName},
+	{field: "TopicArn", tag: "topic", value: topicName},
+}
+
+// WrapSession installs request handlers on s, such that requests made by
+// service clients created from s are reported as spans to Elastic APM, if
+// the request's context contains a sampled transaction. WrapSession returns
+// s for convenience.
+//
+// Service clients copy the session's handlers when they are created, so
+// WrapSession must be called before creating the clients. Requests must
+// be made with the "WithContext" variants of the client methods, e.g.
+// GetObjectWithContext, passing a context that contains a transaction.
+//
+// Spans are named after the service and operation, e.g. "S3 GetObject",
+// and have a type derived from the service, e.g. "aws.s3". The region,
+// AWS request ID, and the bucket, table, queue or topic name targeted by
+// the request are recorded as span tags. Failed requests are also reported
+// as errors.
+//
+// For SQS and SNS, the trace parent is propagated to consumers through
+// message attributes; see SetTransactionParent.
+func WrapSession(s *session.Session) *session.Session {
+	s.Handlers.Build.PushFrontNamed(request.NamedHandler{
+		Name: handlerPrefix + "StartSpan",
+		Fn:   startSpan,
+	})
+	s.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: handlerPrefix + "EndSpan",
+		Fn:   endSpan,
+	})
+	return s
+}
+
+type spanKey struct{}
+
+// startSpan starts a span for the request, if its context contains a
+// sampled transaction. startSpan is called before the request parameters
+// are marshalled, so that the trace parent may be injected into them.
+func startSpan(r *request.Request) {
+	if r.ExpireTime > 0 {
+		// The request is being presigned, and will not be sent.
+		return
+	}
+	ctx := r.Context()
+	tx := elasticapm.TransactionFromContext(ctx)
+	if tx == nil || !tx.Sampled() {
+		return
+	}
+
+	serviceID := r.ClientInfo.ServiceID
+	if serviceID == "" {
+		serviceID = r.ClientInfo.ServiceName
+	}
+	spanType := "aws." + strings.ToLower(strings.Replace(serviceID, " ", "", -1))
+	span := tx.StartSpan(serviceID+" "+r.Operation.Name, spanType, elasticapm.SpanFromContext(ctx))
+	if span.Dropped() {
+		span.End()
+		return
+	}
+	if region := aws.StringValue(r.Config.Region); region != "" {
+		span.Context.SetTag("region", region)
+	}
+	setResourceTags(span, r.Params)
+
+	ctx = elasticapm.ContextWithSpan(ctx, span)
+	r.Params = withTraceParent(ctx, r.Params)
+	r.SetContext(context.WithValue(ctx, spanKey{}, span))
+}
+
+// endSpan ends the span started by startSpan, if any,
+// reporting the request's error if it failed.
+func endSpan(r *request.Request) {
+	ctx := r.Context()
+	span, ok := ctx.Value(spanKey{}).(*elasticapm.Span)
+	if !ok {
+		return
+	}
+	if r.RequestID != "" {
+		span.Context.SetTag("request_id", r.RequestID)
+	}
+	if r.Error != nil {
+		if e := elasticapm.CaptureError(ctx, r.Error); e != nil {
+			e.Send()
+		}
+	}
+	span.End()
+}
+
+// setResourceTags records the values of the well-known resource
+// fields of params, which should be a pointer to a struct, as
+// span tags.
+func setResourceTags(span *elasticapm.Span, params interface{}) {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	v = v.Elem()
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	for _, f := range resourceFields {
+		fv := v.FieldByName(f.field)
+		if !fv.IsValid() || fv.Kind() != reflect.Ptr || fv.IsNil() {
+			continue
+		}
+		s, ok := fv.Elem().Interface().(string)
+		if !ok || s == "" {
+			continue
+		}
+		if f.value != nil {
+			s = f.value(s)
+		}
+		span.Context.SetTag(f.tag, s)
+	}
+}
+
+// queueName returns the name of the queue identified by the SQS queue URL,
+// e.g. "https://sqs.us-east-1.amazonaws.com/123456789012/queue-name".
+func queueName(url string) string {
+	return url[strings.LastIndex(url, "/")+1:]
+}
+
+// topicName returns the name of the topic identified by the SNS topic ARN,
+// e.g. "arn:aws:sns:us-east-1:123456789012:topic-name".
+func topicName(arn string) string {
+	return arn[strings.LastIndex(arn, ":")+1:]
+}
@@ -0,0 +1,206 @@
+package apmawssdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmawssdk"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestS3GetObject(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Amz-Request-Id", "request-id")
+		if req.URL.Path != "/bucket-name/key" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			return
+		}
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	client := s3.New(newSession(t, server.URL))
+	tx, errors := withTransaction(t, func(ctx context.Context) {
+		out, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String("bucket-name"),
+			Key:    aws.String("key"),
+		})
+		require.NoError(t, err)
+		out.Body.Close()
+
+		_, err = client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String("bucket-name"),
+			Key:    aws.String("missing"),
+		})
+		require.Error(t, err)
+	})
+	require.Len(t, tx.Spans, 2)
+	for _, span := range tx.Spans {
+		assert.Equal(t, "S3 GetObject", span.Name)
+		assert.Equal(t, "aws.s3", span.Type)
+		assert.Equal(t, &model.SpanContext{
+			Tags: map[string]string{
+				"region":     "us-east-1",
+				"bucket":     "bucket-name",
+				"request_id": "request-id",
+			},
+		}, span.Context)
+	}
+
+	require.Len(t, errors, 1)
+	assert.Contains(t, errors[0].Exception.Message, "NoSuchKey")
+	assert.Equal(t, tx.ID, errors[0].Transaction.ID)
+	assert.Equal(t, tx.Spans[1].ID, errors[0].ParentID)
+}
+
+func TestSQSSendMessage(t *testing.T) {
+	var traceParent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// SQS uses the JSON protocol in recent versions of
+		// the SDK, and the query protocol in older versions.
+		w.Header().Set("X-Amzn-Requestid", "request-id")
+		if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-amz-json") {
+			var input struct {
+				MessageAttributes map[string]struct {
+					StringValue string
+				}
+			}
+			require.NoError(t, json.NewDecoder(req.Body).Decode(&input))
+			require.Contains(t, input.MessageAttributes, apmawssdk.TraceParentAttribute)
+			traceParent = input.MessageAttributes[apmawssdk.TraceParentAttribute].StringValue
+			w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+			w.Write([]byte(`{"MessageId":"message-id"}`))
+			return
+		}
+		require.NoError(t, req.ParseForm())
+		assert.Equal(t, apmawssdk.TraceParentAttribute, req.PostForm.Get("MessageAttribute.1.Name"))
+		traceParent = req.PostForm.Get("MessageAttribute.1.Value.StringValue")
+		w.Write([]byte(`<SendMessageResponse>
+  <SendMessageResult><MessageId>message-id</MessageId></SendMessageResult>
+  <ResponseMetadata><RequestId>request-id</RequestId></ResponseMetadata>
+</SendMessageResponse>`))
+	}))
+	defer server.Close()
+
+	client := sqs.New(newSession(t, server.URL))
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(server.URL + "/123456789012/queue-name"),
+		MessageBody: aws.String("hello"),
+	}
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		out, err := client.SendMessageWithContext(ctx, input)
+		require.NoError(t, err)
+		assert.Equal(t, "message-id", aws.StringValue(out.MessageId))
+	})
+	assert.NotEmpty(t, traceParent)
+	assert.Nil(t, input.MessageAttributes) // the caller's input is not modified
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, "SQS SendMessage", tx.Spans[0].Name)
+	assert.Equal(t, "aws.sqs", tx.Spans[0].Type)
+	assert.Equal(t, &model.SpanContext{
+		Tags: map[string]string{
+			"region":     "us-east-1",
+			"queue":      "queue-name",
+			"request_id": "request-id",
+		},
+	}, tx.Spans[0].Context)
+
+	// The consumer records the sending span as the parent.
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	consumer := tracer.StartTransaction("consume", "messaging")
+	assert.True(t, apmawssdk.SetTransactionParent(consumer, &sqs.Message{
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			apmawssdk.TraceParentAttribute: {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(traceParent),
+			},
+		},
+	}))
+	consumer.End()
+	tracer.Flush(nil)
+	consumerTransactions := transport.Payloads()[0].Transactions()
+	require.Len(t, consumerTransactions, 1)
+	assert.Equal(t, model.IfaceMap{{
+		Key: "parent",
+		Value: map[string]interface{}{
+			"transaction_id": tx.ID.String(),
+			"span_id":        float64(*tx.Spans[0].ID),
+		},
+	}}, consumerTransactions[0].Context.Custom)
+}
+
+func TestSetTransactionParentMissing(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tx := tracer.StartTransaction("consume", "messaging")
+	defer tx.End()
+	assert.False(t, apmawssdk.SetTransactionParent(tx, &sqs.Message{}))
+}
+
+func TestWrapSessionNoTransaction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	client := s3.New(newSession(t, server.URL))
+	out, err := client.GetObjectWithContext(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket-name"),
+		Key:    aws.String("key"),
+	})
+	require.NoError(t, err)
+	out.Body.Close()
+}
+
+func newSession(t *testing.T, endpoint string) *session.Session {
+	s, err := session.NewSession(&aws.Config{
+		Credentials:             credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:                aws.String(endpoint),
+		Region:                  aws.String("us-east-1"),
+		S3ForcePathStyle:        aws.Bool(true),
+		DisableComputeChecksums: aws.Bool(true),
+		MaxRetries:              aws.Int(0),
+	})
+	require.NoError(t, err)
+	return apmawssdk.WrapSession(s)
+}
+
+func withTransaction(t *testing.T, f func(ctx context.Context)) (model.Transaction, []*model.Error) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	f(ctx)
+
+	tx.End()
+	tracer.Flush(nil)
+	var transactions []model.Transaction
+	var errors []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			errors = append(errors, p.Errors()...)
+		}
+	}
+	require.Len(t, transactions, 1)
+	return transactions[0], errors
+}
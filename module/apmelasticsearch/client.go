@@ -0,0 +1,171 @@
+package apmelasticsearch
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmstrings"
+	"github.com/elastic/apm-agent-go/module/apmhttp"
+)
+
+// maxStatementLength is the maximum length of a span statement,
+// in runes. Search bodies are often large, so this is greater
+// than the limits for other strings.
+const maxStatementLength = 10000
+
+// WrapRoundTripper returns an http.RoundTripper wrapping r, reporting each
+// Elasticsearch request as a span to Elastic APM, if the request's context
+// contains a sampled transaction. The returned http.RoundTripper may be used
+// as the transport for github.com/olivere/elastic or
+// github.com/elastic/go-elasticsearch clients.
+//
+// Spans are named after the method and endpoint, e.g. "POST /_search",
+// excluding the index and document ID so that the number of distinct
+// span names is bounded. Requests which do not target an endpoint are
+// named "METHOD /" for the cluster root, and "METHOD /<index>" for an
+// index. The cluster address and index are recorded as the database
+// instance, and the index is recorded in the "index" tag. If the
+// tracer is configured to capture request bodies for transactions, then
+// the bodies of search requests are recorded as span statements. If the
+// tracer is configured to capture request bodies only for errors, then
+// the bodies are recorded only for requests which fail, or which
+// receive a response with a 4xx or 5xx status code.
+//
+// If r is nil, then http.DefaultTransport is wrapped.
+func WrapRoundTripper(r http.RoundTripper) http.RoundTripper {
+	if r == nil {
+		r = http.DefaultTransport
+	}
+	return &roundTripper{r: r}
+}
+
+type roundTripper struct {
+	r http.RoundTripper
+}
+
+// RoundTrip delegates to r.r, emitting a span if req's context
+// contains a transaction.
+func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	tx := elasticapm.TransactionFromContext(ctx)
+	if tx == nil || !tx.Sampled() {
+		return r.r.RoundTrip(req)
+	}
+
+	name := req.Method + " " + requestEndpoint(req.URL.Path)
+	span := tx.StartSpan(name, "db.elasticsearch", elasticapm.SpanFromContext(ctx))
+	defer span.End()
+	if span.Dropped() {
+		return r.r.RoundTrip(req)
+	}
+
+	var body string
+	captureBody := tx.Tracer().CaptureBody()
+	if captureBody != elasticapm.CaptureBodyOff && isSearchRequest(req) {
+		var err error
+		body, req, err = readBody(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	instance := req.URL.Host
+	if index := requestIndex(req.URL.Path); index != "" {
+		instance += "/" + index
+		span.Context.SetTag("index", index)
+	}
+
+	ctx = elasticapm.ContextWithSpan(ctx, span)
+	req = apmhttp.RequestWithContext(ctx, req)
+	resp, err := r.r.RoundTrip(req)
+
+	// The body is recorded for all requests if capturing bodies
+	// for transactions, and otherwise only for failed requests.
+	var statement string
+	if captureBody&elasticapm.CaptureBodyTransactions != 0 {
+		statement = body
+	} else if captureBody&elasticapm.CaptureBodyErrors != 0 && (err != nil || resp.StatusCode >= 400) {
+		statement = body
+	}
+	span.Context.SetDatabase(elasticapm.DatabaseSpanContext{
+		Instance:  instance,
+		Statement: statement,
+		Type:      "elasticsearch",
+	})
+	return resp, err
+}
+
+// readBody reads and returns the request body, along with a shallow
+// copy of req whose body yields the same content.
+func readBody(req *http.Request) (string, *http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", req, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", nil, err
+	}
+	reqCopy := *req
+	reqCopy.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return apmstrings.Truncate(string(body), maxStatementLength), &reqCopy, nil
+}
+
+// isSearchRequest reports whether req is for an endpoint
+// whose request body describes a query.
+func isSearchRequest(req *http.Request) bool {
+	for _, segment := range strings.Split(req.URL.Path, "/") {
+		if searchEndpoints[segment] {
+			return true
+		}
+	}
+	return false
+}
+
+var searchEndpoints = map[string]bool{
+	"_search":          true,
+	"_msearch":         true,
+	"_count":           true,
+	"_explain":         true,
+	"_validate":        true,
+	"_delete_by_query": true,
+	"_update_by_query": true,
+	"_rollup_search":   true,
+	"_sql":             true,
+}
+
+// requestEndpoint returns the endpoint targeted by the request path,
+// comprising the path segments which begin with an underscore, e.g.
+// "/_search" for "/index/_search", or "/_doc" for "/index/_doc/id".
+func requestEndpoint(path string) string {
+	var endpoint []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "_") {
+			endpoint = append(endpoint, segment)
+		}
+	}
+	switch {
+	case len(endpoint) > 0:
+		return "/" + strings.Join(endpoint, "/")
+	case strings.Trim(path, "/") == "":
+		return "/"
+	}
+	return "/<index>"
+}
+
+// requestIndex returns the index, or comma-separated indices,
+// targeted by the request path, if any.
+func requestIndex(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path = path[:i]
+	}
+	if path == "" || path[0] == '_' {
+		// Endpoints which do not target an
+		// index begin with an underscore.
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,121 @@
+package apmelasticsearch_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmelasticsearch"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestWrapRoundTripper(t *testing.T) {
+	var requestBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		requestBody = string(body)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	const query = `{"query":{"match_all":{}}}`
+	test := func(mode elasticapm.CaptureBodyMode, path, expectName, expectStatement string) {
+		tx := withTransaction(t, mode, func(ctx context.Context) {
+			client := &http.Client{Transport: apmelasticsearch.WrapRoundTripper(nil)}
+			req, err := http.NewRequest("POST", server.URL+path, strings.NewReader(query))
+			require.NoError(t, err)
+			resp, err := client.Do(req.WithContext(ctx))
+			require.NoError(t, err)
+			resp.Body.Close()
+		})
+		assert.Equal(t, query, requestBody)
+		require.Len(t, tx.Spans, 1)
+		assert.Equal(t, expectName, tx.Spans[0].Name)
+		assert.Equal(t, "db.elasticsearch", tx.Spans[0].Type)
+
+		expectContext := &model.SpanContext{
+			Database: &model.DatabaseSpanContext{
+				Instance:  serverURL.Host,
+				Statement: expectStatement,
+				Type:      "elasticsearch",
+			},
+		}
+		if strings.HasPrefix(path, "/users") {
+			expectContext.Database.Instance += "/users"
+			expectContext.Tags = map[string]string{"index": "users"}
+		}
+		assert.Equal(t, expectContext, tx.Spans[0].Context)
+	}
+	test(elasticapm.CaptureBodyOff, "/_search", "POST /_search", "")
+	test(elasticapm.CaptureBodyErrors, "/_search", "POST /_search", "")
+	test(elasticapm.CaptureBodyTransactions, "/_search", "POST /_search", query)
+	test(elasticapm.CaptureBodyAll, "/users/_search", "POST /_search", query)
+	test(elasticapm.CaptureBodyAll, "/users/_doc/1", "POST /_doc", "") // not a search request
+	test(elasticapm.CaptureBodyOff, "/users/_doc/1/_update", "POST /_doc/_update", "")
+	test(elasticapm.CaptureBodyOff, "/users", "POST /<index>", "")
+	test(elasticapm.CaptureBodyOff, "/", "POST /", "")
+}
+
+func TestWrapRoundTripperCaptureBodyErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/missing/_search" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	const query = `{"query":{"match_all":{}}}`
+	tx := withTransaction(t, elasticapm.CaptureBodyErrors, func(ctx context.Context) {
+		client := &http.Client{Transport: apmelasticsearch.WrapRoundTripper(nil)}
+		for _, path := range []string{"/users/_search", "/missing/_search"} {
+			req, err := http.NewRequest("POST", server.URL+path, strings.NewReader(query))
+			require.NoError(t, err)
+			resp, err := client.Do(req.WithContext(ctx))
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+	})
+	require.Len(t, tx.Spans, 2)
+	assert.Equal(t, "", tx.Spans[0].Context.Database.Statement)
+	assert.Equal(t, query, tx.Spans[1].Context.Database.Statement)
+}
+
+func TestWrapRoundTripperNoTransaction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	client := &http.Client{Transport: apmelasticsearch.WrapRoundTripper(nil)}
+	resp, err := client.Get(server.URL + "/_search")
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func withTransaction(t *testing.T, mode elasticapm.CaptureBodyMode, f func(ctx context.Context)) model.Transaction {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetCaptureBody(mode)
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	f(ctx)
+
+	tx.End()
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	transactions := payloads[0].Transactions()
+	require.Len(t, transactions, 1)
+	return transactions[0]
+}
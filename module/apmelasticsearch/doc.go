@@ -0,0 +1,3 @@
+// Package apmelasticsearch provides support for tracing the
+// HTTP transport layer of Elasticsearch clients.
+package apmelasticsearch
@@ -0,0 +1,4 @@
+// Package apmexpvar provides an elasticapm.MetricsGatherer which
+// gathers numeric variables published through the standard library
+// "expvar" package.
+package apmexpvar
@@ -0,0 +1,137 @@
+package apmexpvar
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+// NewGatherer returns an elasticapm.MetricsGatherer which gathers
+// numeric expvar variables, reporting them as gauges by default.
+//
+// Each variable's value is decoded as JSON. Values of nested objects,
+// such as those of an expvar.Map or the "memstats" variable, are
+// reported with names formed by joining the object keys with dots,
+// e.g. "memstats.HeapAlloc". Strings, booleans, arrays, and nulls
+// are ignored.
+//
+// Rules, specified with WithRules, control how values are reported.
+// By default, MemStatsRules are used. Use WithMapLabel to report the
+// entries of a map as a single metric with a label.
+func NewGatherer(o ...Option) elasticapm.MetricsGatherer {
+	g := &gatherer{
+		rules:     MemStatsRules,
+		mapLabels: make(map[string]string),
+	}
+	for _, o := range o {
+		o(g)
+	}
+	return g
+}
+
+type gatherer struct {
+	rules     []Rule
+	mapLabels map[string]string
+}
+
+// GatherMetrics gathers expvar metrics into m.
+func (g *gatherer) GatherMetrics(ctx context.Context, m *elasticapm.Metrics) error {
+	var firstErr error
+	expvar.Do(func(kv expvar.KeyValue) {
+		var value interface{}
+		decoder := json.NewDecoder(strings.NewReader(kv.Value.String()))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "failed to decode expvar %q", kv.Key)
+			}
+			return
+		}
+		g.gather(m, kv.Key, nil, value)
+	})
+	return firstErr
+}
+
+func (g *gatherer) gather(m *elasticapm.Metrics, name string, labels []elasticapm.MetricLabel, value interface{}) {
+	switch value := value.(type) {
+	case json.Number:
+		if f, err := value.Float64(); err == nil {
+			g.addMetric(m, name, labels, f)
+		}
+	case map[string]interface{}:
+		label, ok := g.mapLabels[name]
+		if !ok {
+			g.gatherEntries(m, name, labels, value)
+			return
+		}
+		for k, v := range value {
+			labels := append(labels[:len(labels):len(labels)], elasticapm.MetricLabel{
+				Name: label, Value: k,
+			})
+			if entries, ok := v.(map[string]interface{}); ok {
+				g.gatherEntries(m, name, labels, entries)
+			} else {
+				g.gather(m, name, labels, v)
+			}
+		}
+	}
+}
+
+func (g *gatherer) gatherEntries(m *elasticapm.Metrics, prefix string, labels []elasticapm.MetricLabel, entries map[string]interface{}) {
+	for k, v := range entries {
+		g.gather(m, prefix+"."+k, labels, v)
+	}
+}
+
+func (g *gatherer) addMetric(m *elasticapm.Metrics, name string, labels []elasticapm.MetricLabel, value float64) {
+	var rule Rule
+	for _, r := range g.rules {
+		if r.Pattern != nil && r.Pattern.MatchString(name) {
+			rule = r
+			break
+		}
+	}
+	if rule.Ignore {
+		return
+	}
+	if len(labels) > 1 {
+		sort.Slice(labels, func(i, j int) bool {
+			return labels[i].Name < labels[j].Name
+		})
+	}
+	if rule.Counter {
+		m.AddCounter(name, rule.Unit, labels, value)
+	} else {
+		m.AddGauge(name, rule.Unit, labels, value)
+	}
+}
+
+// Option sets options for the gatherer returned by NewGatherer.
+type Option func(*gatherer)
+
+// WithRules returns an Option which adds rules for reporting values.
+// The rules take precedence over any previously specified rules,
+// including the default rules.
+func WithRules(rules ...Rule) Option {
+	return func(g *gatherer) {
+		g.rules = append(rules[:len(rules):len(rules)], g.rules...)
+	}
+}
+
+// WithMapLabel returns an Option which causes the entries of the map
+// with the given (dotted) name to be reported as a single metric with
+// that name, labeled with the entry key. For example, given an expvar.Map
+// "requests" with entries {"GET": 1, "POST": 2}, WithMapLabel("requests",
+// "method") will cause two "requests" metrics to be reported, labeled
+// with method=GET and method=POST.
+func WithMapLabel(name, label string) Option {
+	return func(g *gatherer) {
+		g.mapLabels[name] = label
+	}
+}
@@ -0,0 +1,100 @@
+package apmexpvar_test
+
+import (
+	"expvar"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmexpvar"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func init() {
+	expvar.NewInt("apmexpvar_test.int").Set(123)
+	expvar.NewFloat("apmexpvar_test.float").Set(1.5)
+	expvar.NewString("apmexpvar_test.string").Set("ignored")
+
+	requests := expvar.NewMap("apmexpvar_test.requests")
+	requests.Add("GET", 1)
+	requests.Add("POST", 2)
+
+	nested := expvar.NewMap("apmexpvar_test.nested")
+	inner := new(expvar.Map).Init()
+	inner.Add("value", 3)
+	nested.Set("inner", inner)
+}
+
+func TestGatherer(t *testing.T) {
+	metrics := gatherMetrics(apmexpvar.NewGatherer(
+		apmexpvar.WithMapLabel("apmexpvar_test.requests", "method"),
+		apmexpvar.WithRules(apmexpvar.Rule{
+			Pattern: regexp.MustCompile(`^apmexpvar_test\.float$`),
+			Unit:    "sec",
+		}),
+	))
+
+	var unlabeled *model.Metrics
+	var labeled []*model.Metrics
+	for _, m := range metrics {
+		if len(m.Labels) == 0 {
+			unlabeled = m
+		} else {
+			labeled = append(labeled, m)
+		}
+	}
+	require.NotNil(t, unlabeled)
+	assert.Equal(t, model.Metric{Type: "gauge", Value: newFloat64(123)}, unlabeled.Samples["apmexpvar_test.int"])
+	assert.Equal(t, model.Metric{Type: "gauge", Unit: "sec", Value: newFloat64(1.5)}, unlabeled.Samples["apmexpvar_test.float"])
+	assert.Equal(t, model.Metric{Type: "gauge", Value: newFloat64(3)}, unlabeled.Samples["apmexpvar_test.nested.inner.value"])
+	assert.NotContains(t, unlabeled.Samples, "apmexpvar_test.string")
+	assert.NotContains(t, unlabeled.Samples, "apmexpvar_test.requests.GET")
+
+	assert.Equal(t, model.Metric{Type: "counter", Unit: "byte", Value: unlabeled.Samples["memstats.TotalAlloc"].Value}, unlabeled.Samples["memstats.TotalAlloc"])
+	assert.Equal(t, "byte", unlabeled.Samples["memstats.HeapInuse"].Unit)
+	assert.Equal(t, "gauge", unlabeled.Samples["memstats.HeapInuse"].Type)
+
+	require.Len(t, labeled, 2)
+	assert.Equal(t, model.StringMap{{Key: "method", Value: "GET"}}, labeled[0].Labels)
+	assert.Equal(t, map[string]model.Metric{
+		"apmexpvar_test.requests": {Type: "gauge", Value: newFloat64(1)},
+	}, labeled[0].Samples)
+	assert.Equal(t, model.StringMap{{Key: "method", Value: "POST"}}, labeled[1].Labels)
+	assert.Equal(t, map[string]model.Metric{
+		"apmexpvar_test.requests": {Type: "gauge", Value: newFloat64(2)},
+	}, labeled[1].Samples)
+}
+
+func TestGathererIgnoreRule(t *testing.T) {
+	metrics := gatherMetrics(apmexpvar.NewGatherer(
+		apmexpvar.WithRules(apmexpvar.Rule{
+			Pattern: regexp.MustCompile(`^(memstats|apmexpvar_test)\.`),
+			Ignore:  true,
+		}),
+	))
+	for _, m := range metrics {
+		for name := range m.Samples {
+			assert.NotRegexp(t, `^(memstats|apmexpvar_test)\.`, name)
+		}
+	}
+}
+
+func gatherMetrics(g elasticapm.MetricsGatherer) []*model.Metrics {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.RegisterMetricsGatherer(g)
+	tracer.SendMetrics(nil)
+	metrics := transport.Payloads()[0].Metrics()
+	for _, m := range metrics {
+		m.Timestamp = model.Time{}
+	}
+	return metrics
+}
+
+func newFloat64(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,50 @@
+package apmexpvar
+
+import "regexp"
+
+// Rule controls how matching expvar values are reported.
+type Rule struct {
+	// Pattern is matched against the dotted names of values,
+	// e.g. "memstats.HeapAlloc". The first matching rule is
+	// applied; values not matching any rule are reported as
+	// gauges without a unit.
+	Pattern *regexp.Regexp
+
+	// Ignore, if true, causes matching values to be ignored.
+	Ignore bool
+
+	// Counter, if true, causes matching values to be reported
+	// as counters rather than gauges. Only values which are
+	// known to be monotonically increasing should be reported
+	// as counters.
+	Counter bool
+
+	// Unit holds the unit to report for matching values,
+	// e.g. "byte".
+	Unit string
+}
+
+// MemStatsRules holds rules for reporting the runtime.MemStats
+// values published in the "memstats" variable by the expvar
+// package.
+var MemStatsRules = []Rule{{
+	Pattern: regexp.MustCompile(`^memstats\.TotalAlloc$`),
+	Counter: true,
+	Unit:    "byte",
+}, {
+	Pattern: regexp.MustCompile(`^memstats\.(Lookups|Mallocs|Frees|NumGC|NumForcedGC)$`),
+	Counter: true,
+}, {
+	Pattern: regexp.MustCompile(`^memstats\.PauseTotalNs$`),
+	Counter: true,
+	Unit:    "ns",
+}, {
+	Pattern: regexp.MustCompile(`^memstats\.(Alloc|Sys|NextGC)$`),
+	Unit:    "byte",
+}, {
+	Pattern: regexp.MustCompile(`^memstats\.(Heap|Stack|MSpan|MCache)(Alloc|Sys|Idle|Inuse|Released)$`),
+	Unit:    "byte",
+}, {
+	Pattern: regexp.MustCompile(`^memstats\.(BuckHashSys|GCSys|OtherSys)$`),
+	Unit:    "byte",
+}}
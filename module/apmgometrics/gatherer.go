@@ -2,6 +2,7 @@ package apmgometrics
 
 import (
 	"context"
+	"time"
 
 	"github.com/rcrowley/go-metrics"
 
@@ -10,12 +11,22 @@ import (
 
 // Wrap wraps r, a go-metrics Registry, so that it can be used
 // as an elasticapm.MetricsGatherer.
-func Wrap(r metrics.Registry) elasticapm.MetricsGatherer {
-	return gatherer{r}
+func Wrap(r metrics.Registry, o ...Option) elasticapm.MetricsGatherer {
+	g := gatherer{r: r}
+	for _, o := range o {
+		o(&g)
+	}
+	return g
 }
 
 type gatherer struct {
 	r metrics.Registry
+
+	// monotonicCounters holds the names of counters which
+	// are declared to be monotonically increasing. If
+	// allCountersMonotonic is true, this is ignored.
+	monotonicCounters    map[string]bool
+	allCountersMonotonic bool
 }
 
 // GatherMEtrics gathers metrics into m.
@@ -24,10 +35,13 @@ func (g gatherer) GatherMetrics(ctx context.Context, m *elasticapm.Metrics) erro
 		switch v := v.(type) {
 		case metrics.Counter:
 			// NOTE(axw) in go-metrics, counters can go up and down,
-			// hence we use a gauge here. Should we provide config
-			// to allow a user to specify that a counter is always
-			// increasing, hence represent it as a counter type?
-			m.AddGauge(name, "", nil, float64(v.Count()))
+			// hence we use a gauge here unless the user has declared
+			// the counter to be monotonically increasing.
+			if g.allCountersMonotonic || g.monotonicCounters[name] {
+				m.AddCounter(name, "", nil, float64(v.Count()))
+			} else {
+				m.AddGauge(name, "", nil, float64(v.Count()))
+			}
 		case metrics.Gauge:
 			m.AddGauge(name, "", nil, float64(v.Value()))
 		case metrics.GaugeFloat64:
@@ -48,9 +62,75 @@ func (g gatherer) GatherMetrics(ctx context.Context, m *elasticapm.Metrics) erro
 				Max:       &max,
 				Quantiles: quantiles,
 			})
-		default:
-			// TODO(axw) Meter, Timer, EWMA
+		case metrics.Meter:
+			v = v.Snapshot()
+			m.AddCounter(name+".count", "", nil, float64(v.Count()))
+			addRates(m, name, v)
+		case metrics.Timer:
+			// go-metrics timers record durations in nanoseconds;
+			// we report them in seconds.
+			v = v.Snapshot()
+			seconds := func(ns float64) float64 {
+				return ns / float64(time.Second)
+			}
+			stddev := seconds(v.StdDev())
+			min := seconds(float64(v.Min()))
+			max := seconds(float64(v.Max()))
+			quantiles := map[float64]float64{0.5: 0, 0.9: 0, 0.99: 0}
+			for q := range quantiles {
+				quantiles[q] = seconds(v.Percentile(q))
+			}
+			m.AddSummary(name, "sec", nil, elasticapm.SummaryMetric{
+				Count:     uint64(v.Count()),
+				Sum:       seconds(float64(v.Sum())),
+				Stddev:    &stddev,
+				Min:       &min,
+				Max:       &max,
+				Quantiles: quantiles,
+			})
+			addRates(m, name, v)
+		case metrics.EWMA:
+			m.AddGauge(name+".rate", "", nil, v.Snapshot().Rate())
 		}
 	})
 	return nil
 }
+
+// rates is the interface common to go-metrics meters and timers
+// for obtaining the rate of events per second.
+type rates interface {
+	Rate1() float64
+	Rate5() float64
+	Rate15() float64
+	RateMean() float64
+}
+
+func addRates(m *elasticapm.Metrics, name string, r rates) {
+	m.AddGauge(name+".rate1", "", nil, r.Rate1())
+	m.AddGauge(name+".rate5", "", nil, r.Rate5())
+	m.AddGauge(name+".rate15", "", nil, r.Rate15())
+	m.AddGauge(name+".rate_mean", "", nil, r.RateMean())
+}
+
+// Option sets options for the gatherer returned by Wrap.
+type Option func(*gatherer)
+
+// WithMonotonicCounters returns an Option which declares the
+// go-metrics counters with the given names as monotonically
+// increasing, so that they are reported as counter metrics
+// rather than gauges. If no names are specified, all counters
+// are declared monotonically increasing.
+func WithMonotonicCounters(names ...string) Option {
+	return func(g *gatherer) {
+		if len(names) == 0 {
+			g.allCountersMonotonic = true
+			return
+		}
+		if g.monotonicCounters == nil {
+			g.monotonicCounters = make(map[string]bool)
+		}
+		for _, name := range names {
+			g.monotonicCounters[name] = true
+		}
+	}
+}
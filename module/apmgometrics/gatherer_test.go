@@ -3,9 +3,11 @@ package apmgometrics_test
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/rcrowley/go-metrics"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/apm-agent-go"
 	"github.com/elastic/apm-agent-go/model"
@@ -74,6 +76,97 @@ func TestHistogram(t *testing.T) {
 	}, metrics[0].Samples["histogram"])
 }
 
+func TestMonotonicCounters(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("requests", r).Inc(123)
+	metrics.GetOrRegisterCounter("inflight", r).Inc(10)
+
+	test := func(o apmgometrics.Option, expectRequests, expectInflight string) {
+		metrics := gatherMetrics(apmgometrics.Wrap(r, o))
+		assert.Equal(t, expectRequests, metrics[0].Samples["requests"].Type)
+		assert.Equal(t, expectInflight, metrics[0].Samples["inflight"].Type)
+	}
+	test(apmgometrics.WithMonotonicCounters("requests"), "counter", "gauge")
+	test(apmgometrics.WithMonotonicCounters(), "counter", "counter")
+}
+
+func TestMeter(t *testing.T) {
+	r := metrics.NewRegistry()
+	meter := metrics.GetOrRegisterMeter("meter", r)
+	defer meter.Stop()
+	meter.Mark(3)
+
+	metrics := gatherMetrics(apmgometrics.Wrap(r))
+	samples := metrics[0].Samples
+	assert.Equal(t, model.Metric{Type: "counter", Value: newFloat64(3)}, samples["meter.count"])
+	for _, name := range []string{"meter.rate1", "meter.rate5", "meter.rate15", "meter.rate_mean"} {
+		if assert.Contains(t, samples, name) {
+			assert.Equal(t, "gauge", samples[name].Type)
+			assert.NotNil(t, samples[name].Value)
+		}
+	}
+}
+
+func TestTimer(t *testing.T) {
+	r := metrics.NewRegistry()
+	timer := metrics.GetOrRegisterTimer("timer", r)
+	defer timer.Stop()
+	timer.Update(50 * time.Millisecond)
+	timer.Update(100 * time.Millisecond)
+	timer.Update(150 * time.Millisecond)
+
+	metrics := gatherMetrics(apmgometrics.Wrap(r))
+	samples := metrics[0].Samples
+	summary := samples["timer"]
+	require.NotNil(t, summary.Stddev)
+	assert.InDelta(t, 0.0408, *summary.Stddev, 0.0001)
+	summary.Stddev = nil
+	assert.Equal(t, model.Metric{
+		Type:  "summary",
+		Unit:  "sec",
+		Count: newUint64(3),
+		Sum:   newFloat64(0.3),
+		Min:   newFloat64(0.05),
+		Max:   newFloat64(0.15),
+		Quantiles: []model.Quantile{
+			{Quantile: 0.5, Value: 0.1},
+			{Quantile: 0.9, Value: 0.15},
+			{Quantile: 0.99, Value: 0.15},
+		},
+	}, summary)
+	for _, name := range []string{"timer.rate1", "timer.rate5", "timer.rate15", "timer.rate_mean"} {
+		if assert.Contains(t, samples, name) {
+			assert.Equal(t, "gauge", samples[name].Type)
+		}
+	}
+}
+
+func TestEWMA(t *testing.T) {
+	// StandardRegistry does not accept EWMAs,
+	// but other Registry implementations may.
+	ewma := metrics.NewEWMA1()
+	r := ewmaRegistry{metrics.NewRegistry(), "ewma", ewma}
+	ewma.Update(60)
+	ewma.Tick()
+
+	metrics := gatherMetrics(apmgometrics.Wrap(r))
+	assert.Equal(t, model.Metric{
+		Type:  "gauge",
+		Value: newFloat64(ewma.Rate()),
+	}, metrics[0].Samples["ewma.rate"])
+}
+
+type ewmaRegistry struct {
+	metrics.Registry
+	name string
+	ewma metrics.EWMA
+}
+
+func (r ewmaRegistry) Each(f func(string, interface{})) {
+	r.Registry.Each(f)
+	f(r.name, r.ewma)
+}
+
 func gatherMetrics(g elasticapm.MetricsGatherer) []*model.Metrics {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
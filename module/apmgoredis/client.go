@@ -0,0 +1,199 @@
+package apmgoredis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmredisutil"
+)
+
+// Client is the interface returned by Wrap.
+//
+// Client implements redis.UniversalClient.
+type Client interface {
+	redis.UniversalClient
+
+	// RedisClient returns the wrapped *redis.Client, with
+	// the client's current context, or nil if a
+	// non-*redis.Client was wrapped. Commands executed by
+	// the returned client are not reported.
+	RedisClient() *redis.Client
+
+	// WithContext returns a shallow copy of the client with its
+	// context changed to ctx, which reports commands and pipelines
+	// as spans within the transaction and span in ctx, if any.
+	//
+	// To report commands as spans, ctx must contain a transaction
+	// or span, e.g. the context of an HTTP request instrumented by
+	// module/apmhttp.
+	WithContext(ctx context.Context) Client
+}
+
+// Wrap wraps client such that executed commands, pipelines, and
+// transactions are reported as spans to Elastic APM, using the client's
+// associated context (see redis.Client.Context). A client with a
+// different context may be obtained by using Client.WithContext.
+// The client passed to Wrap is not modified.
+//
+// To report commands as spans, the context must contain a transaction
+// or span. A client wrapped once at program startup will generally
+// have a background context, and so must be used via WithContext.
+//
+// Wrap supports *redis.Client and *redis.ClusterClient. Commands
+// executed by other clients will not be reported.
+func Wrap(client redis.UniversalClient, o ...Option) Client {
+	cfg := &clientConfig{}
+	for _, o := range o {
+		o(cfg)
+	}
+	switch client := client.(type) {
+	case *redis.Client:
+		cfg.instance = strconv.Itoa(client.Options().DB)
+		return newContextClient(client, cfg)
+	case *redis.ClusterClient:
+		return newContextClusterClient(client, cfg)
+	}
+	return contextUniversalClient{UniversalClient: client}
+}
+
+type contextClient struct {
+	// Client is a copy of client which
+	// reports commands as spans.
+	*redis.Client
+	client *redis.Client
+	cfg    *clientConfig
+}
+
+// newContextClient returns a contextClient which reports commands
+// executed by client as spans, using client's associated context.
+func newContextClient(client *redis.Client, cfg *clientConfig) contextClient {
+	ctx := client.Context()
+	c := contextClient{Client: client.WithContext(ctx), client: client, cfg: cfg}
+	c.WrapProcess(process(ctx, cfg))
+	c.WrapProcessPipeline(processPipeline(ctx, cfg))
+	return c
+}
+
+func (c contextClient) WithContext(ctx context.Context) Client {
+	// Copy the uninstrumented client, so
+	// commands are not reported twice.
+	return newContextClient(c.client.WithContext(ctx), c.cfg)
+}
+
+func (c contextClient) RedisClient() *redis.Client {
+	return c.client
+}
+
+type contextClusterClient struct {
+	// ClusterClient is a copy of client
+	// which reports commands as spans.
+	*redis.ClusterClient
+	client *redis.ClusterClient
+	cfg    *clientConfig
+}
+
+// newContextClusterClient returns a contextClusterClient which reports
+// commands executed by client as spans, using client's associated
+// context.
+func newContextClusterClient(client *redis.ClusterClient, cfg *clientConfig) contextClusterClient {
+	ctx := client.Context()
+	c := contextClusterClient{ClusterClient: client.WithContext(ctx), client: client, cfg: cfg}
+	c.WrapProcess(process(ctx, cfg))
+	c.WrapProcessPipeline(processPipeline(ctx, cfg))
+	return c
+}
+
+func (c contextClusterClient) WithContext(ctx context.Context) Client {
+	// Copy the uninstrumented client, so
+	// commands are not reported twice.
+	return newContextClusterClient(c.client.WithContext(ctx), c.cfg)
+}
+
+func (c contextClusterClient) RedisClient() *redis.Client {
+	return nil
+}
+
+type contextUniversalClient struct {
+	redis.UniversalClient
+}
+
+func (c contextUniversalClient) WithContext(ctx context.Context) Client {
+	return c
+}
+
+func (c contextUniversalClient) RedisClient() *redis.Client {
+	return nil
+}
+
+func process(ctx context.Context, cfg *clientConfig) func(oldProcess func(redis.Cmder) error) func(redis.Cmder) error {
+	return func(oldProcess func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			name := cmd.Name()
+			span, ctx := elasticapm.StartSpan(ctx, strings.ToUpper(name), "db.redis."+name)
+			if !span.Dropped() {
+				var statement string
+				if cfg.statements {
+					statement = formatStatement(cmd)
+				}
+				setDatabaseContext(span, cfg, statement)
+			}
+			err := oldProcess(cmd)
+			finishSpan(ctx, span, err)
+			return err
+		}
+	}
+}
+
+func processPipeline(ctx context.Context, cfg *clientConfig) func(oldProcess func([]redis.Cmder) error) func([]redis.Cmder) error {
+	return func(oldProcess func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			span, ctx := elasticapm.StartSpan(ctx, "(pipeline)", "db.redis.pipeline")
+			if !span.Dropped() {
+				var statement string
+				if cfg.statements {
+					statements := make([]string, len(cmds))
+					for i, cmd := range cmds {
+						statements[i] = formatStatement(cmd)
+					}
+					statement = strings.Join(statements, "\n")
+				}
+				setDatabaseContext(span, cfg, statement)
+			}
+			err := oldProcess(cmds)
+			finishSpan(ctx, span, err)
+			return err
+		}
+	}
+}
+
+func setDatabaseContext(span *elasticapm.Span, cfg *clientConfig, statement string) {
+	span.Context.SetDatabase(elasticapm.DatabaseSpanContext{
+		Instance:  cfg.instance,
+		Statement: apmredisutil.Truncate(statement),
+		Type:      "redis",
+	})
+}
+
+func finishSpan(ctx context.Context, span *elasticapm.Span, err error) {
+	span.End()
+	if err == redis.Nil {
+		// redis.Nil is returned when a key does not
+		// exist, and is not considered a failure.
+		return
+	}
+	if e := elasticapm.CaptureError(ctx, err); e != nil {
+		e.Send()
+	}
+}
+
+func formatStatement(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) == 0 {
+		return ""
+	}
+	return apmredisutil.FormatStatement(cmd.Name(), args[1:])
+}
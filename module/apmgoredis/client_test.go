@@ -0,0 +1,192 @@
+package apmgoredis_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmgoredis"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestCommand(t *testing.T) {
+	client, closeClient := newClient(t)
+	defer closeClient()
+	tx, errors := withTransaction(t, func(ctx context.Context) {
+		client := client.WithContext(ctx)
+		require.NoError(t, client.Set("key", "value", 0).Err())
+		assert.Equal(t, redis.Nil, client.Get("missing").Err())
+	})
+	require.Len(t, tx.Spans, 2)
+	assert.Equal(t, "SET", tx.Spans[0].Name)
+	assert.Equal(t, "db.redis.set", tx.Spans[0].Type)
+	assert.Equal(t, &model.SpanContext{
+		Database: &model.DatabaseSpanContext{
+			Instance: "0",
+			Type:     "redis",
+		},
+	}, tx.Spans[0].Context)
+	assert.Equal(t, "GET", tx.Spans[1].Name)
+	assert.Equal(t, "db.redis.get", tx.Spans[1].Type)
+	assert.Empty(t, errors) // redis.Nil is not reported
+}
+
+func TestCommandError(t *testing.T) {
+	client, closeClient := newClient(t)
+	defer closeClient()
+	tx, errors := withTransaction(t, func(ctx context.Context) {
+		client := client.WithContext(ctx)
+		require.NoError(t, client.Set("key", "value", 0).Err())
+		assert.Error(t, client.Incr("key").Err())
+	})
+	require.Len(t, tx.Spans, 2)
+	require.Len(t, errors, 1)
+	assert.Equal(t, tx.ID, errors[0].Transaction.ID)
+	assert.Equal(t, tx.Spans[1].ID, errors[0].ParentID)
+}
+
+func TestPipeline(t *testing.T) {
+	client, closeClient := newClient(t, apmgoredis.WithStatements())
+	defer closeClient()
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		_, err := client.WithContext(ctx).Pipelined(func(p redis.Pipeliner) error {
+			p.Set("key", "value", 0)
+			p.Get("key")
+			return nil
+		})
+		require.NoError(t, err)
+	})
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, "(pipeline)", tx.Spans[0].Name)
+	assert.Equal(t, "db.redis.pipeline", tx.Spans[0].Type)
+	assert.Equal(t, "SET key ?\nGET key", tx.Spans[0].Context.Database.Statement)
+}
+
+func TestTxPipeline(t *testing.T) {
+	client, closeClient := newClient(t, apmgoredis.WithStatements())
+	defer closeClient()
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		pipe := client.WithContext(ctx).TxPipeline()
+		pipe.Incr("counter")
+		pipe.Expire("counter", time.Hour)
+		_, err := pipe.Exec()
+		require.NoError(t, err)
+
+		_, err = client.WithContext(ctx).TxPipelined(func(p redis.Pipeliner) error {
+			p.Get("counter")
+			return nil
+		})
+		require.NoError(t, err)
+	})
+	require.Len(t, tx.Spans, 2)
+	assert.Equal(t, "(pipeline)", tx.Spans[0].Name)
+	assert.Equal(t, "db.redis.pipeline", tx.Spans[0].Type)
+	assert.Equal(t, "INCR counter\nEXPIRE counter ?", tx.Spans[0].Context.Database.Statement)
+	assert.Equal(t, "(pipeline)", tx.Spans[1].Name)
+	assert.Equal(t, "GET counter", tx.Spans[1].Context.Database.Statement)
+}
+
+func TestWrapContext(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		redisClient := redis.NewClient(&redis.Options{Addr: s.Addr()}).WithContext(ctx)
+		defer redisClient.Close()
+
+		// Wrap uses the client's associated context.
+		client := apmgoredis.Wrap(redisClient)
+		require.NoError(t, client.Set("key", "value", 0).Err())
+		_, err := client.TxPipelined(func(p redis.Pipeliner) error {
+			p.Get("key")
+			return nil
+		})
+		require.NoError(t, err)
+
+		// Commands executed by the WithContext client,
+		// or by the original client, are reported once.
+		require.NoError(t, client.WithContext(ctx).Get("key").Err())
+		require.NoError(t, redisClient.Get("key").Err())
+	})
+	require.Len(t, tx.Spans, 3)
+	assert.Equal(t, "SET", tx.Spans[0].Name)
+	assert.Equal(t, "(pipeline)", tx.Spans[1].Name)
+	assert.Equal(t, "GET", tx.Spans[2].Name)
+}
+
+func TestStatements(t *testing.T) {
+	client, closeClient := newClient(t, apmgoredis.WithStatements())
+	defer closeClient()
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		client := client.WithContext(ctx)
+		client.Set("key", "secret", 0)
+		client.HSet("hash", "field", 123)
+		client.Set("long", strings.Repeat("x", 2000), 0)
+		client.Get(strings.Repeat("k", 2000))
+	})
+	require.Len(t, tx.Spans, 4)
+	assert.Equal(t, "SET key ?", tx.Spans[0].Context.Database.Statement)
+	assert.Equal(t, "HSET hash ? ?", tx.Spans[1].Context.Database.Statement)
+	assert.Equal(t, "SET long ?", tx.Spans[2].Context.Database.Statement)
+	assert.Len(t, tx.Spans[3].Context.Database.Statement, 1024)
+}
+
+func TestWithoutTransaction(t *testing.T) {
+	client, closeClient := newClient(t)
+	defer closeClient()
+	require.NoError(t, client.WithContext(context.Background()).Ping().Err())
+	require.NoError(t, client.Ping().Err())
+}
+
+func TestRedisClient(t *testing.T) {
+	redisClient := redis.NewClient(&redis.Options{})
+	defer redisClient.Close()
+	assert.Equal(t, redisClient, apmgoredis.Wrap(redisClient).RedisClient())
+
+	clusterClient := redis.NewClusterClient(&redis.ClusterOptions{})
+	defer clusterClient.Close()
+	assert.Nil(t, apmgoredis.Wrap(clusterClient).RedisClient())
+}
+
+func newClient(t *testing.T, o ...apmgoredis.Option) (apmgoredis.Client, func()) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	return apmgoredis.Wrap(client, o...), func() {
+		client.Close()
+		s.Close()
+	}
+}
+
+func withTransaction(t *testing.T, f func(ctx context.Context)) (model.Transaction, []*model.Error) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	f(ctx)
+
+	tx.End()
+	tracer.Flush(nil)
+	var transactions []model.Transaction
+	var errors []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			errors = append(errors, p.Errors()...)
+		}
+	}
+	require.Len(t, transactions, 1)
+	return transactions[0], errors
+}
@@ -0,0 +1,3 @@
+// Package apmgoredis provides helpers for tracing github.com/go-redis/redis
+// client operations as spans.
+package apmgoredis
@@ -0,0 +1,20 @@
+package apmgoredis
+
+// Option sets options for the client returned by Wrap.
+type Option func(*clientConfig)
+
+type clientConfig struct {
+	instance   string
+	statements bool
+}
+
+// WithStatements returns an Option which causes commands to be
+// recorded as span statements. Statements are sanitized: only the
+// command name and its first argument, which is usually the key,
+// are recorded; all other arguments are replaced with "?". Long
+// statements are truncated.
+func WithStatements() Option {
+	return func(cfg *clientConfig) {
+		cfg.statements = true
+	}
+}
@@ -0,0 +1,3 @@
+// Package apmgorm provides support for tracing
+// github.com/jinzhu/gorm database operations.
+package apmgorm
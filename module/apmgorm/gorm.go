@@ -0,0 +1,168 @@
+package apmgorm
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/module/apmsql"
+)
+
+const (
+	contextKey = "elasticapm:context"
+	spanKey    = "elasticapm:span"
+)
+
+// Open returns a *gorm.DB for the given dialect and arguments, as for
+// gorm.Open, with callbacks registered by RegisterCallbacks such that
+// database operations are reported as spans.
+//
+// If the first argument is a data source name, it is parsed with the
+// DSN parser of the apmsql driver registered for the dialect, e.g. by
+// importing github.com/elastic/apm-agent-go/module/apmsql/pq for the
+// "postgres" dialect, to record the database instance and user in spans.
+//
+// Statements executed with DB.Exec are not reported; see RegisterCallbacks.
+func Open(dialect string, args ...interface{}) (*gorm.DB, error) {
+	db, err := gorm.Open(dialect, args...)
+	if err != nil {
+		return nil, err
+	}
+	var dsnInfo apmsql.DSNInfo
+	if len(args) > 0 {
+		if dsn, ok := args[0].(string); ok {
+			dsnInfo = apmsql.DriverDSNParser(dialect)(dsn)
+		}
+	}
+	registerCallbacks(db, dsnInfo)
+	return db, nil
+}
+
+// WithContext returns a copy of db with ctx recorded for use by
+// the callbacks registered by RegisterCallbacks. If ctx contains
+// a transaction, then operations performed with the returned
+// *gorm.DB are reported as spans within it.
+func WithContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	return db.Set(contextKey, ctx)
+}
+
+// RegisterCallbacks registers callbacks on db for reporting database
+// operations as spans, if db has been associated with a context
+// containing a transaction by WithContext.
+//
+// Spans are named after the operation and table, e.g. "SELECT users",
+// and record the generated SQL as the statement, and the number of
+// rows affected as a tag. Errors other than gorm.ErrRecordNotFound
+// are also reported.
+//
+// Queries made with DB.Raw are reported, as they are executed by
+// the query or row query callbacks (e.g. DB.Raw(...).Scan). However,
+// GORM has no callback for raw statements: those executed with DB.Exec
+// bypass GORM's callbacks, and are passed to the driver without a
+// context, so they are not reported even when using an apmsql driver.
+// To report them, start a span around the call, e.g. with
+// elasticapm.StartSpan.
+//
+// RegisterCallbacks does not have access to the data source name,
+// so the database instance and user are not recorded in spans;
+// use Open to record them.
+func RegisterCallbacks(db *gorm.DB) {
+	registerCallbacks(db, apmsql.DSNInfo{})
+}
+
+func registerCallbacks(db *gorm.DB, dsnInfo apmsql.DSNInfo) {
+	dbType := db.Dialect().GetName()
+	if dbType == "postgres" {
+		// Be consistent with apmsql.
+		dbType = "postgresql"
+	}
+	callback := db.Callback()
+	registerCallback(callback.Create, "create", dbType, dsnInfo)
+	registerCallback(callback.Query, "query", dbType, dsnInfo)
+	registerCallback(callback.Update, "update", dbType, dsnInfo)
+	registerCallback(callback.Delete, "delete", dbType, dsnInfo)
+	registerCallback(callback.RowQuery, "row_query", dbType, dsnInfo)
+}
+
+// operations maps the names of GORM callback
+// processors to SQL verbs used in span names.
+var operations = map[string]string{
+	"create":    "INSERT",
+	"query":     "SELECT",
+	"update":    "UPDATE",
+	"delete":    "DELETE",
+	"row_query": "SELECT",
+}
+
+// registerCallback registers callbacks before and after the GORM callback
+// with the given name. Each registration requires a new processor, as
+// CallbackProcessor.Before and After modify the processor.
+func registerCallback(processor func() *gorm.CallbackProcessor, name, dbType string, dsnInfo apmsql.DSNInfo) {
+	gormCallbackName := "gorm:" + name
+	verb := operations[name]
+	spanType := "db." + dbType + ".exec"
+	if verb == "SELECT" {
+		spanType = "db." + dbType + ".query"
+	}
+	processor().Before(gormCallbackName).Register(
+		"elasticapm:before_"+name,
+		func(scope *gorm.Scope) {
+			ctx, ok := scopeContext(scope)
+			if !ok {
+				return
+			}
+			tx := elasticapm.TransactionFromContext(ctx)
+			if tx == nil || !tx.Sampled() {
+				return
+			}
+			// The span is renamed after the callback, when the
+			// table name is more likely to be known.
+			span := tx.StartSpan(verb, spanType, elasticapm.SpanFromContext(ctx))
+			scope.InstanceSet(spanKey, span)
+		},
+	)
+	processor().After(gormCallbackName).Register(
+		"elasticapm:after_"+name,
+		func(scope *gorm.Scope) {
+			v, ok := scope.InstanceGet(spanKey)
+			if !ok {
+				return
+			}
+			span := v.(*elasticapm.Span)
+			defer span.End()
+			if span.Dropped() {
+				return
+			}
+			if table := scope.TableName(); table != "" {
+				span.Name = verb + " " + table
+			}
+			span.Context.SetDatabase(elasticapm.DatabaseSpanContext{
+				Instance:  dsnInfo.Database,
+				Statement: strings.TrimSpace(scope.SQL),
+				Type:      "sql",
+				User:      dsnInfo.User,
+			})
+			db := scope.DB()
+			span.Context.SetTag("rows_affected", strconv.FormatInt(db.RowsAffected, 10))
+			if db.Error != nil && !gorm.IsRecordNotFoundError(db.Error) {
+				ctx, _ := scopeContext(scope)
+				ctx = elasticapm.ContextWithSpan(ctx, span)
+				if e := elasticapm.CaptureError(ctx, db.Error); e != nil {
+					e.Send()
+				}
+			}
+		},
+	)
+}
+
+func scopeContext(scope *gorm.Scope) (context.Context, bool) {
+	v, ok := scope.Get(contextKey)
+	if !ok {
+		return nil, false
+	}
+	ctx, ok := v.(context.Context)
+	return ctx, ok
+}
@@ -0,0 +1,151 @@
+package apmgorm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmgorm"
+	_ "github.com/elastic/apm-agent-go/module/apmsql/sqlite3"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+type Product struct {
+	gorm.Model
+	Code  string
+	Price uint
+}
+
+func TestCallbacks(t *testing.T) {
+	db, err := apmgorm.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.AutoMigrate(&Product{})
+
+	tx, errors := withTransaction(t, func(ctx context.Context) {
+		db := apmgorm.WithContext(ctx, db)
+		db.Create(&Product{Code: "L1212", Price: 1000})
+
+		var product Product
+		assert.NoError(t, db.First(&product, "code = ?", "L1212").Error)
+		assert.NoError(t, db.Model(&product).Update("Price", 2000).Error)
+		assert.NoError(t, db.Delete(&product).Error)
+		assert.True(t, gorm.IsRecordNotFoundError(db.First(&product, "code = ?", "L1212").Error))
+
+		var count int
+		assert.NoError(t, db.Model(&Product{}).Unscoped().Count(&count).Error)
+		assert.Equal(t, 1, count)
+		assert.Error(t, db.Table("missing").Find(&product).Error)
+	})
+	assert.Len(t, errors, 1)
+
+	var names []string
+	for _, span := range tx.Spans {
+		names = append(names, span.Name)
+	}
+	assert.Equal(t, []string{
+		"INSERT products",
+		"SELECT products",
+		"UPDATE products",
+		"DELETE products", // soft delete, recorded with the ORM operation
+		"SELECT products",
+		"SELECT products",
+		"SELECT missing",
+	}, names)
+
+	assert.Equal(t, "db.sqlite3.exec", tx.Spans[0].Type)
+	assert.Equal(t, "db.sqlite3.query", tx.Spans[1].Type)
+	require.NotNil(t, tx.Spans[1].Context)
+	assert.Equal(t, &model.DatabaseSpanContext{
+		Instance:  ":memory:",
+		Statement: `SELECT * FROM "products"  WHERE "products"."deleted_at" IS NULL AND ((code = ?)) ORDER BY "products"."id" ASC LIMIT 1`,
+		Type:      "sql",
+	}, tx.Spans[1].Context.Database)
+	assert.Equal(t, map[string]string{"rows_affected": "1"}, tx.Spans[2].Context.Tags)
+	assert.Equal(t, tx.Spans[6].ID, errors[0].ParentID)
+}
+
+func TestCallbacksRaw(t *testing.T) {
+	db, err := apmgorm.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.AutoMigrate(&Product{})
+
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		db := apmgorm.WithContext(ctx, db)
+		var products []Product
+		assert.NoError(t, db.Raw("SELECT * FROM products").Scan(&products).Error)
+		rows, err := db.Raw("SELECT code FROM products").Rows()
+		require.NoError(t, err)
+		rows.Close()
+
+		// DB.Exec bypasses the callbacks, and is not reported.
+		assert.NoError(t, db.Exec("DELETE FROM products").Error)
+	})
+	require.Len(t, tx.Spans, 2)
+	assert.Equal(t, "SELECT * FROM products", tx.Spans[0].Context.Database.Statement)
+	assert.Equal(t, "SELECT code FROM products", tx.Spans[1].Context.Database.Statement)
+}
+
+func TestCallbacksNoContext(t *testing.T) {
+	db, err := apmgorm.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.AutoMigrate(&Product{})
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tx := tracer.StartTransaction("name", "type")
+	assert.NoError(t, db.Create(&Product{Code: "L1212", Price: 1000}).Error)
+	tx.End()
+	tracer.Flush(nil)
+
+	transactions := transport.Payloads()[0].Transactions()
+	require.Len(t, transactions, 1)
+	assert.Empty(t, transactions[0].Spans)
+}
+
+func TestRegisterCallbacks(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	apmgorm.RegisterCallbacks(db)
+	db.AutoMigrate(&Product{})
+
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		apmgorm.WithContext(ctx, db).Create(&Product{Code: "L1212", Price: 1000})
+	})
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, "INSERT products", tx.Spans[0].Name)
+	assert.Equal(t, "", tx.Spans[0].Context.Database.Instance)
+}
+
+func withTransaction(t *testing.T, f func(ctx context.Context)) (model.Transaction, []*model.Error) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	f(ctx)
+
+	tx.End()
+	tracer.Flush(nil)
+	var transactions []model.Transaction
+	var errors []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			errors = append(errors, p.Errors()...)
+		}
+	}
+	require.Len(t, transactions, 1)
+	return transactions[0], errors
+}
@@ -0,0 +1,4 @@
+// Package apmlog provides an io.Writer, and a *log.Logger constructor,
+// for reporting lines logged through the standard library "log"
+// package as errors to Elastic APM.
+package apmlog
@@ -0,0 +1,87 @@
+package apmlog
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Level is the severity level of a log record.
+type Level int
+
+const (
+	// LevelDebug is the level for debug log records.
+	LevelDebug Level = iota
+
+	// LevelInfo is the level for informational log records.
+	LevelInfo
+
+	// LevelWarning is the level for warning log records.
+	LevelWarning
+
+	// LevelError is the level for error log records.
+	LevelError
+
+	// LevelFatal is the level for fatal log records.
+	LevelFatal
+)
+
+// String returns the lower-cased name of the level, e.g. "error".
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarning:
+		return "warning"
+	case LevelError:
+		return "error"
+	case LevelFatal:
+		return "fatal"
+	}
+	return ""
+}
+
+var (
+	levelNames = map[string]Level{
+		"debug":    LevelDebug,
+		"info":     LevelInfo,
+		"warn":     LevelWarning,
+		"warning":  LevelWarning,
+		"err":      LevelError,
+		"error":    LevelError,
+		"crit":     LevelFatal,
+		"critical": LevelFatal,
+		"fatal":    LevelFatal,
+		"panic":    LevelFatal,
+	}
+
+	// levelPrefixRegexp matches level prefixes such as
+	// "[ERROR]", "[error]:", and "WARN:". A bare level
+	// name without brackets or a colon is not matched,
+	// so that messages like "Error connecting to ..."
+	// are not misinterpreted.
+	levelPrefixRegexp = regexp.MustCompile(
+		`^(?i:\[([a-z]+)\]:?|([a-z]+):)\s*`,
+	)
+)
+
+// parseLevel parses a level prefix from the log message, returning the
+// level and the message with the prefix removed. If the message has no
+// recognised level prefix, defaultLevel and the unmodified message are
+// returned.
+func parseLevel(msg string, defaultLevel Level) (Level, string) {
+	m := levelPrefixRegexp.FindStringSubmatch(msg)
+	if m == nil {
+		return defaultLevel, msg
+	}
+	name := m[1]
+	if name == "" {
+		name = m[2]
+	}
+	level, ok := levelNames[strings.ToLower(name)]
+	if !ok {
+		return defaultLevel, msg
+	}
+	return level, msg[len(m[0]):]
+}
@@ -0,0 +1,136 @@
+package apmlog
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+// logHeaderRegexp matches the header written by the standard library's
+// log.Logger for the flags Ldate, Ltime, Lmicroseconds, Llongfile, and
+// Lshortfile.
+var logHeaderRegexp = regexp.MustCompile(
+	`^(?:\d{4}/\d{2}/\d{2} )?(?:\d{2}:\d{2}:\d{2}(?:\.\d+)? )?(?:\S+\.go:\d+: )?`,
+)
+
+// NewWriter returns an io.Writer which reports each line written to it
+// as an error log record to Elastic APM.
+//
+// Lines may be prefixed with a level, e.g. "[ERROR] ..." or "WARN: ...",
+// and any standard log.Logger header (date, time, and file) preceding
+// the level will be skipped. Lines without a recognised level prefix
+// are given the level specified by WithDefaultLevel, which defaults to
+// LevelError. Lines with a level lower than that specified by WithLevel,
+// which also defaults to LevelError, are discarded.
+//
+// By default, the returned Writer will use elasticapm.DefaultTracer.
+// Use WithTracer to specify an alternative tracer.
+//
+// The returned Writer may be passed to log.SetOutput to capture
+// all logging through the standard logger.
+func NewWriter(o ...Option) io.Writer {
+	w := &writer{
+		tracer:       elasticapm.DefaultTracer,
+		level:        LevelError,
+		defaultLevel: LevelError,
+	}
+	for _, o := range o {
+		o(w)
+	}
+	return w
+}
+
+// NewLogger returns a new *log.Logger with the given prefix and flags,
+// writing to an io.Writer returned by NewWriter with the given options.
+func NewLogger(prefix string, flag int, o ...Option) *log.Logger {
+	w := NewWriter(o...).(*writer)
+	w.prefix = prefix
+	return log.New(w, prefix, flag)
+}
+
+type writer struct {
+	tracer       *elasticapm.Tracer
+	level        Level
+	defaultLevel Level
+	loggerName   string
+	prefix       string
+}
+
+// Write reports each line in p as an error log record, and
+// always returns len(p), nil.
+func (w *writer) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line, p = p[:i], p[i+1:]
+		} else {
+			p = nil
+		}
+		w.writeLine(string(line))
+	}
+	return n, nil
+}
+
+func (w *writer) writeLine(line string) {
+	// The prefix precedes the header unless the
+	// log.Lmsgprefix flag is specified, in which
+	// case it follows the header.
+	line = strings.TrimPrefix(line, w.prefix)
+	line = line[len(logHeaderRegexp.FindString(line)):]
+	line = strings.TrimPrefix(line, w.prefix)
+
+	level, msg := parseLevel(line, w.defaultLevel)
+	if level < w.level || strings.TrimSpace(msg) == "" {
+		return
+	}
+	e := w.tracer.NewErrorLog(elasticapm.ErrorLogRecord{
+		Message:    msg,
+		Level:      level.String(),
+		LoggerName: w.loggerName,
+	})
+	e.SetStacktrace(2)
+	e.Send()
+}
+
+// Option sets options for a Writer.
+type Option func(*writer)
+
+// WithTracer returns an Option which sets t as the tracer
+// to use for reporting log records.
+func WithTracer(t *elasticapm.Tracer) Option {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(w *writer) {
+		w.tracer = t
+	}
+}
+
+// WithLevel returns an Option which sets the minimum level of log
+// records to report. Log records with a lower level are discarded.
+func WithLevel(level Level) Option {
+	return func(w *writer) {
+		w.level = level
+	}
+}
+
+// WithDefaultLevel returns an Option which sets the level given to
+// log records without a recognised level prefix.
+func WithDefaultLevel(level Level) Option {
+	return func(w *writer) {
+		w.defaultLevel = level
+	}
+}
+
+// WithLoggerName returns an Option which sets the logger name
+// recorded for each log record.
+func WithLoggerName(name string) Option {
+	return func(w *writer) {
+		w.loggerName = name
+	}
+}
@@ -0,0 +1,80 @@
+package apmlog_test
+
+import (
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmlog"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestLogger(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	logger := apmlog.NewLogger(
+		"prefix: ", log.LstdFlags|log.Lshortfile,
+		apmlog.WithTracer(tracer),
+		apmlog.WithLevel(apmlog.LevelWarning),
+		apmlog.WithLoggerName("stdlib"),
+	)
+	logger.Printf("[DEBUG] ignored")
+	logger.Printf("INFO: ignored")
+	logger.Printf("[WARN] disk %d%% full", 90)
+	logger.Printf("[error]: connection refused")
+	logger.Printf("Error connecting to server")
+	tracer.Flush(nil)
+
+	errors := payloadErrors(transport.Payloads())
+	require.Len(t, errors, 3)
+	assert.Equal(t, model.Log{
+		Message:    "disk 90% full",
+		Level:      "warning",
+		LoggerName: "stdlib",
+	}, withoutStacktrace(errors[0].Log))
+	assert.Equal(t, model.Log{
+		Message:    "connection refused",
+		Level:      "error",
+		LoggerName: "stdlib",
+	}, withoutStacktrace(errors[1].Log))
+	assert.Equal(t, model.Log{
+		Message:    "Error connecting to server",
+		Level:      "error",
+		LoggerName: "stdlib",
+	}, withoutStacktrace(errors[2].Log))
+	assert.Equal(t, "TestLogger", errors[0].Culprit)
+}
+
+func TestWriterDefaultLevel(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	w := apmlog.NewWriter(
+		apmlog.WithTracer(tracer),
+		apmlog.WithDefaultLevel(apmlog.LevelInfo),
+	)
+	w.Write([]byte("2018/08/01 12:34:56 unprefixed\n2018/08/01 12:34:56 FATAL: prefixed\n\n"))
+	tracer.Flush(nil)
+
+	errors := payloadErrors(transport.Payloads())
+	require.Len(t, errors, 1)
+	assert.Equal(t, "prefixed", errors[0].Log.Message)
+	assert.Equal(t, "fatal", errors[0].Log.Level)
+}
+
+func payloadErrors(payloads transporttest.Payloads) []*model.Error {
+	var errors []*model.Error
+	for _, p := range payloads {
+		errors = append(errors, p.Errors()...)
+	}
+	return errors
+}
+
+func withoutStacktrace(l model.Log) model.Log {
+	l.Stacktrace = nil
+	return l
+}
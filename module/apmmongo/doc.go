@@ -0,0 +1,4 @@
+// Package apmmongo provides an event.CommandMonitor for the official
+// MongoDB Go driver (go.mongodb.org/mongo-driver), for tracing commands
+// as spans.
+package apmmongo
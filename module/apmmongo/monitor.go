@@ -0,0 +1,179 @@
+package apmmongo
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmstrings"
+)
+
+// maxStatementLength is the maximum length of a span
+// statement, in runes.
+const maxStatementLength = 1024
+
+// CommandMonitor returns a new event.CommandMonitor which will report a
+// span for each command executed within a context containing a sampled
+// transaction. Commands which fail are additionally reported as errors.
+//
+// Spans are named after the collection and command, e.g. "users.find".
+// Command documents may contain sensitive data, such as the documents
+// being inserted or updated, so they are not recorded by default. Use
+// WithCommandCapture(true) to record the command document as the span
+// statement, and WithRedactedFields to redact sensitive values from
+// the statements.
+func CommandMonitor(o ...Option) *event.CommandMonitor {
+	m := &commandMonitor{
+		redactedFields: make(map[string]bool),
+		spans:          make(map[commandKey]*elasticapm.Span),
+	}
+	for _, o := range o {
+		o(m)
+	}
+	return &event.CommandMonitor{
+		Started:   m.started,
+		Succeeded: m.succeeded,
+		Failed:    m.failed,
+	}
+}
+
+type commandMonitor struct {
+	captureCommands bool
+	redactedFields  map[string]bool
+
+	mu    sync.Mutex
+	spans map[commandKey]*elasticapm.Span
+}
+
+// commandKey correlates command started and
+// finished events for a connection.
+type commandKey struct {
+	connectionID string
+	requestID    int64
+}
+
+func (m *commandMonitor) started(ctx context.Context, event *event.CommandStartedEvent) {
+	name := event.CommandName
+	if collection := collectionName(event.CommandName, event.Command); collection != "" {
+		name = collection + "." + name
+	}
+	span, _ := elasticapm.StartSpan(ctx, name, "db.mongodb.query")
+	if span.Dropped() {
+		span.End()
+		return
+	}
+	var statement string
+	if m.captureCommands {
+		statement = m.formatCommand(event.Command)
+	}
+	span.Context.SetDatabase(elasticapm.DatabaseSpanContext{
+		Instance:  event.DatabaseName,
+		Statement: statement,
+		Type:      "mongodb",
+	})
+	key := commandKey{connectionID: event.ConnectionID, requestID: event.RequestID}
+	m.mu.Lock()
+	m.spans[key] = span
+	m.mu.Unlock()
+}
+
+func (m *commandMonitor) succeeded(ctx context.Context, event *event.CommandSucceededEvent) {
+	if span := m.finished(&event.CommandFinishedEvent); span != nil {
+		span.End()
+	}
+}
+
+func (m *commandMonitor) failed(ctx context.Context, event *event.CommandFailedEvent) {
+	span := m.finished(&event.CommandFinishedEvent)
+	if span == nil {
+		return
+	}
+	span.End()
+	ctx = elasticapm.ContextWithSpan(ctx, span)
+	if e := elasticapm.CaptureError(ctx, errors.New(event.Failure)); e != nil {
+		e.Send()
+	}
+}
+
+// finished removes and returns the span for the command
+// identified by event, or nil if there is none. The span's
+// duration is set to the command's duration.
+func (m *commandMonitor) finished(event *event.CommandFinishedEvent) *elasticapm.Span {
+	key := commandKey{connectionID: event.ConnectionID, requestID: event.RequestID}
+	m.mu.Lock()
+	span, ok := m.spans[key]
+	if ok {
+		delete(m.spans, key)
+	}
+	m.mu.Unlock()
+	if span != nil && event.Duration > 0 {
+		span.Duration = event.Duration
+	}
+	return span
+}
+
+// collectionName returns the name of the collection targeted by the
+// command, if any. For most commands, the collection name is the value
+// of the command name field; for getMore, it is held in the "collection"
+// field.
+func collectionName(commandName string, command bson.Raw) string {
+	field := commandName
+	if commandName == "getMore" {
+		field = "collection"
+	}
+	value, err := command.LookupErr(field)
+	if err != nil {
+		return ""
+	}
+	collection, _ := value.StringValueOK()
+	return collection
+}
+
+// formatCommand returns the command formatted as relaxed extended
+// JSON, omitting session and cluster metadata fields, and redacting
+// the values of any configured fields.
+func (m *commandMonitor) formatCommand(command bson.Raw) string {
+	var doc bson.D
+	if err := bson.Unmarshal(command, &doc); err != nil {
+		return ""
+	}
+	filtered := doc[:0]
+	for _, elem := range doc {
+		if elem.Key == "lsid" || elem.Key == "txnNumber" || (elem.Key != "" && elem.Key[0] == '$') {
+			continue
+		}
+		filtered = append(filtered, elem)
+	}
+	out, err := bson.MarshalExtJSON(m.redact(filtered), false, false)
+	if err != nil {
+		return ""
+	}
+	return apmstrings.Truncate(string(out), maxStatementLength)
+}
+
+// redact returns value with the values of the configured
+// fields replaced by "?", at any depth.
+func (m *commandMonitor) redact(value interface{}) interface{} {
+	if len(m.redactedFields) == 0 {
+		return value
+	}
+	switch value := value.(type) {
+	case bson.D:
+		for i, elem := range value {
+			if m.redactedFields[elem.Key] {
+				value[i].Value = "?"
+			} else {
+				value[i].Value = m.redact(elem.Value)
+			}
+		}
+	case bson.A:
+		for i, elem := range value {
+			value[i] = m.redact(elem)
+		}
+	}
+	return value
+}
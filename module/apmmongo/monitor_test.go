@@ -0,0 +1,179 @@
+package apmmongo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmmongo"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestCommandMonitor(t *testing.T) {
+	monitor := apmmongo.CommandMonitor(apmmongo.WithCommandCapture(true))
+	tx, errors := withTransaction(t, func(ctx context.Context) {
+		monitor.Started(ctx, &event.CommandStartedEvent{
+			Command: mustMarshal(t, bson.D{
+				{Key: "find", Value: "users"},
+				{Key: "filter", Value: bson.D{{Key: "name", Value: "bob"}}},
+				{Key: "lsid", Value: bson.D{{Key: "id", Value: 1}}},
+				{Key: "$db", Value: "test"},
+			}),
+			DatabaseName: "test",
+			CommandName:  "find",
+			RequestID:    1,
+			ConnectionID: "conn",
+		})
+		monitor.Succeeded(ctx, &event.CommandSucceededEvent{
+			CommandFinishedEvent: event.CommandFinishedEvent{
+				Duration:     123 * time.Millisecond,
+				CommandName:  "find",
+				DatabaseName: "test",
+				RequestID:    1,
+				ConnectionID: "conn",
+			},
+		})
+	})
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, "users.find", tx.Spans[0].Name)
+	assert.Equal(t, "db.mongodb.query", tx.Spans[0].Type)
+	assert.Equal(t, 123.0, tx.Spans[0].Duration)
+	assert.Equal(t, &model.SpanContext{
+		Database: &model.DatabaseSpanContext{
+			Instance:  "test",
+			Statement: `{"find":"users","filter":{"name":"bob"}}`,
+			Type:      "mongodb",
+		},
+	}, tx.Spans[0].Context)
+	assert.Empty(t, errors)
+}
+
+func TestCommandMonitorFailed(t *testing.T) {
+	monitor := apmmongo.CommandMonitor()
+	tx, errors := withTransaction(t, func(ctx context.Context) {
+		// Interleave two commands to check that
+		// events are correlated by request ID.
+		for _, requestID := range []int64{1, 2} {
+			monitor.Started(ctx, &event.CommandStartedEvent{
+				Command:      mustMarshal(t, bson.D{{Key: "ping", Value: 1}}),
+				DatabaseName: "admin",
+				CommandName:  "ping",
+				RequestID:    requestID,
+				ConnectionID: "conn",
+			})
+		}
+		monitor.Failed(ctx, &event.CommandFailedEvent{
+			CommandFinishedEvent: event.CommandFinishedEvent{
+				CommandName:  "ping",
+				RequestID:    2,
+				ConnectionID: "conn",
+			},
+			Failure: "boom",
+		})
+		monitor.Succeeded(ctx, &event.CommandSucceededEvent{
+			CommandFinishedEvent: event.CommandFinishedEvent{
+				CommandName:  "ping",
+				RequestID:    1,
+				ConnectionID: "conn",
+			},
+		})
+	})
+	require.Len(t, tx.Spans, 2)
+	assert.Equal(t, "ping", tx.Spans[0].Name)
+	assert.Equal(t, "ping", tx.Spans[1].Name)
+
+	require.Len(t, errors, 1)
+	assert.Equal(t, "boom", errors[0].Exception.Message)
+	assert.Equal(t, tx.ID, errors[0].Transaction.ID)
+	assert.Equal(t, tx.Spans[1].ID, errors[0].ParentID)
+}
+
+func TestCommandMonitorRedaction(t *testing.T) {
+	command := mustMarshal(t, bson.D{
+		{Key: "insert", Value: "users"},
+		{Key: "documents", Value: bson.A{
+			bson.D{{Key: "name", Value: "bob"}, {Key: "password", Value: "secret"}},
+		}},
+	})
+	started := func(monitor *event.CommandMonitor) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			monitor.Started(ctx, &event.CommandStartedEvent{
+				Command:      command,
+				DatabaseName: "test",
+				CommandName:  "insert",
+				RequestID:    1,
+			})
+			monitor.Succeeded(ctx, &event.CommandSucceededEvent{
+				CommandFinishedEvent: event.CommandFinishedEvent{RequestID: 1},
+			})
+		}
+	}
+
+	tx, _ := withTransaction(t, started(apmmongo.CommandMonitor(
+		apmmongo.WithCommandCapture(true),
+		apmmongo.WithRedactedFields("password"),
+	)))
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, "users.insert", tx.Spans[0].Name)
+	assert.Equal(t,
+		`{"insert":"users","documents":[{"name":"bob","password":"?"}]}`,
+		tx.Spans[0].Context.Database.Statement,
+	)
+
+	// Commands are not captured by default.
+	tx, _ = withTransaction(t, started(apmmongo.CommandMonitor()))
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, "users.insert", tx.Spans[0].Name)
+	assert.Empty(t, tx.Spans[0].Context.Database.Statement)
+}
+
+func TestCommandMonitorNoTransaction(t *testing.T) {
+	monitor := apmmongo.CommandMonitor()
+	ctx := context.Background()
+	monitor.Started(ctx, &event.CommandStartedEvent{
+		Command:     mustMarshal(t, bson.D{{Key: "ping", Value: 1}}),
+		CommandName: "ping",
+		RequestID:   1,
+	})
+	monitor.Failed(ctx, &event.CommandFailedEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{RequestID: 1},
+		Failure:              "boom",
+	})
+}
+
+func mustMarshal(t *testing.T, doc bson.D) bson.Raw {
+	data, err := bson.Marshal(doc)
+	require.NoError(t, err)
+	return data
+}
+
+func withTransaction(t *testing.T, f func(ctx context.Context)) (model.Transaction, []*model.Error) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	f(ctx)
+
+	tx.End()
+	tracer.Flush(nil)
+	var transactions []model.Transaction
+	var errors []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			errors = append(errors, p.Errors()...)
+		}
+	}
+	require.Len(t, transactions, 1)
+	return transactions[0], errors
+}
@@ -0,0 +1,26 @@
+package apmmongo
+
+// Option sets options for the monitor returned by CommandMonitor.
+type Option func(*commandMonitor)
+
+// WithCommandCapture returns an Option which controls whether command
+// documents are recorded as span statements. Commands are not captured
+// by default, as they may contain sensitive data.
+func WithCommandCapture(capture bool) Option {
+	return func(m *commandMonitor) {
+		m.captureCommands = capture
+	}
+}
+
+// WithRedactedFields returns an Option which causes the values of
+// fields with the given names, at any depth within a command document,
+// to be replaced with "?" in span statements. For example, to prevent
+// passwords stored in a "users" collection from being reported, use
+// WithRedactedFields("password").
+func WithRedactedFields(names ...string) Option {
+	return func(m *commandMonitor) {
+		for _, name := range names {
+			m.redactedFields[name] = true
+		}
+	}
+}
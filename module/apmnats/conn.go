@@ -0,0 +1,123 @@
+package apmnats
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+)
+
+// Conn is the interface for publishing messages
+// and making requests, implemented by *nats.Conn.
+type Conn interface {
+	PublishMsg(msg *nats.Msg) error
+	RequestMsgWithContext(ctx context.Context, msg *nats.Msg) (*nats.Msg, error)
+	HeadersSupported() bool
+}
+
+// Publish publishes data to the given subject with nc, as for PublishMsg.
+func Publish(ctx context.Context, nc Conn, subj string, data []byte, o ...PublishOption) error {
+	return PublishMsg(ctx, nc, &nats.Msg{Subject: subj, Data: data}, o...)
+}
+
+// PublishMsg publishes msg with nc, reporting a span if ctx contains a
+// sampled transaction, and recording the trace parent in the headers
+// of the published message.
+//
+// The trace parent is recorded in a copy of msg; msg is not modified.
+// If the server does not support headers, the trace parent is not
+// propagated unless the WithEnvelope option is used.
+func PublishMsg(ctx context.Context, nc Conn, msg *nats.Msg, o ...PublishOption) error {
+	span, ctx, msg := startSpan(ctx, "NATS PUBLISH to "+msg.Subject, "messaging.nats.publish", msg, nc, o)
+	if span == nil {
+		return nc.PublishMsg(msg)
+	}
+	defer span.End()
+	err := nc.PublishMsg(msg)
+	if err != nil {
+		captureError(ctx, err)
+	}
+	return err
+}
+
+// Request sends a request with data to the given subject
+// with nc, and waits for a reply, as for RequestMsg.
+func Request(ctx context.Context, nc Conn, subj string, data []byte, o ...PublishOption) (*nats.Msg, error) {
+	return RequestMsg(ctx, nc, &nats.Msg{Subject: subj, Data: data}, o...)
+}
+
+// RequestMsg sends msg as a request with nc, and waits for a reply. A span
+// measuring the time until the reply is received is reported if ctx contains
+// a sampled transaction, and the trace parent is propagated as described for
+// PublishMsg. The request is cancelled when ctx is done.
+func RequestMsg(ctx context.Context, nc Conn, msg *nats.Msg, o ...PublishOption) (*nats.Msg, error) {
+	span, spanCtx, msg := startSpan(ctx, "NATS REQUEST to "+msg.Subject, "messaging.nats.request", msg, nc, o)
+	if span == nil {
+		return nc.RequestMsgWithContext(ctx, msg)
+	}
+	defer span.End()
+	reply, err := nc.RequestMsgWithContext(ctx, msg)
+	if err != nil {
+		captureError(spanCtx, err)
+	}
+	return reply, err
+}
+
+// startSpan starts a span with the given name and type, and returns
+// the message to send: a copy of msg recording the span as its trace
+// parent, or msg itself if the trace parent cannot be recorded. If ctx
+// does not contain a sampled transaction, or the span is dropped,
+// startSpan returns a nil span.
+func startSpan(
+	ctx context.Context, name, spanType string,
+	msg *nats.Msg, nc Conn, o []PublishOption,
+) (*elasticapm.Span, context.Context, *nats.Msg) {
+	tx := elasticapm.TransactionFromContext(ctx)
+	if tx == nil || !tx.Sampled() {
+		return nil, ctx, msg
+	}
+	span := tx.StartSpan(name, spanType, elasticapm.SpanFromContext(ctx))
+	if span.Dropped() {
+		span.End()
+		return nil, ctx, msg
+	}
+	span.Context.SetTag("subject", msg.Subject)
+	ctx = elasticapm.ContextWithSpan(ctx, span)
+	if p, ok := apmtraceparent.FromContext(ctx); ok {
+		var opts publishOptions
+		for _, o := range o {
+			o(&opts)
+		}
+		msg = withTraceParent(msg, p, nc.HeadersSupported(), opts.envelope)
+	}
+	return span, ctx, msg
+}
+
+type publishOptions struct {
+	envelope bool
+}
+
+// PublishOption sets options for publishing messages
+// and making requests.
+type PublishOption func(*publishOptions)
+
+// WithEnvelope returns a PublishOption which enables propagating the
+// trace parent through servers that do not support message headers,
+// by wrapping the message data in an envelope holding the trace parent.
+//
+// Subscribers must use WrapHandler to unwrap the data, so this should
+// only be used if all subscribers to the subject are instrumented.
+// Data which is already wrapped in an envelope is not wrapped again.
+func WithEnvelope() PublishOption {
+	return func(o *publishOptions) {
+		o.envelope = true
+	}
+}
+
+func captureError(ctx context.Context, err error) {
+	if e := elasticapm.CaptureError(ctx, err); e != nil {
+		e.Send()
+	}
+}
@@ -0,0 +1,207 @@
+package apmnats_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmnats"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestPublishHandler(t *testing.T) {
+	for _, headers := range []bool{true, false} {
+		var received []byte
+		var receivedCtx context.Context
+		handler, transactions := withHandlerTracer(t, func(ctx context.Context, msg *nats.Msg) {
+			receivedCtx = ctx
+			received = msg.Data
+		})
+		conn := &fakeConn{headers: headers, handler: handler}
+		tx, _ := withTransaction(t, func(ctx context.Context) {
+			err := apmnats.Publish(ctx, conn, "subject", []byte("hello"), apmnats.WithEnvelope())
+			require.NoError(t, err)
+		})
+		assert.Equal(t, "hello", string(received))
+		assert.NotNil(t, elasticapm.TransactionFromContext(receivedCtx))
+		if headers {
+			assert.NotEmpty(t, conn.msgs[0].Header)
+		} else {
+			assert.Empty(t, conn.msgs[0].Header)
+		}
+
+		require.Len(t, tx.Spans, 1)
+		assert.Equal(t, "NATS PUBLISH to subject", tx.Spans[0].Name)
+		assert.Equal(t, "messaging.nats.publish", tx.Spans[0].Type)
+		assert.Equal(t, &model.SpanContext{Tags: map[string]string{"subject": "subject"}}, tx.Spans[0].Context)
+
+		receiverTransactions := transactions()
+		require.Len(t, receiverTransactions, 1)
+		assert.Equal(t, "NATS RECEIVE from subject", receiverTransactions[0].Name)
+		assert.Equal(t, "messaging", receiverTransactions[0].Type)
+		assert.Equal(t, model.IfaceMap{{
+			Key: "parent",
+			Value: map[string]interface{}{
+				"transaction_id": tx.ID.String(),
+				"span_id":        float64(*tx.Spans[0].ID),
+			},
+		}}, receiverTransactions[0].Context.Custom)
+	}
+}
+
+func TestPublishNoHeadersUnwrappedSubscriber(t *testing.T) {
+	// Without WithEnvelope, the message data is not modified
+	// when the server does not support headers, so subscribers
+	// need not use WrapHandler.
+	var received []*nats.Msg
+	conn := &fakeConn{handler: func(msg *nats.Msg) {
+		received = append(received, msg)
+	}}
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		err := apmnats.Publish(ctx, conn, "subject", []byte("hello"))
+		require.NoError(t, err)
+	})
+	require.Len(t, tx.Spans, 1)
+	require.Len(t, received, 1)
+	assert.Equal(t, "hello", string(received[0].Data))
+	assert.Empty(t, received[0].Header)
+}
+
+func TestPublishMsgReused(t *testing.T) {
+	for _, headers := range []bool{true, false} {
+		var received []*nats.Msg
+		conn := &fakeConn{headers: headers, handler: func(msg *nats.Msg) {
+			received = append(received, msg)
+		}}
+		msg := &nats.Msg{
+			Subject: "subject",
+			Header:  nats.Header{"Key": []string{"value"}},
+			Data:    []byte("hello"),
+		}
+		tx, _ := withTransaction(t, func(ctx context.Context) {
+			for i := 0; i < 2; i++ {
+				err := apmnats.PublishMsg(ctx, conn, msg, apmnats.WithEnvelope())
+				require.NoError(t, err)
+			}
+		})
+		require.Len(t, tx.Spans, 2)
+
+		// The caller's message is not modified, and each
+		// published message records its own trace parent.
+		assert.Equal(t, nats.Header{"Key": []string{"value"}}, msg.Header)
+		assert.Equal(t, "hello", string(msg.Data))
+		require.Len(t, received, 2)
+		assert.NotEqual(t, received[0], received[1])
+		for _, msg := range received {
+			if headers {
+				assert.Equal(t, "value", msg.Header.Get("Key"))
+				assert.Equal(t, "hello", string(msg.Data))
+			} else {
+				assert.Equal(t, 1, strings.Count(string(msg.Data), "NATS/1.0"))
+			}
+		}
+	}
+}
+
+func TestRequest(t *testing.T) {
+	handler, transactions := withHandlerTracer(t, func(ctx context.Context, msg *nats.Msg) {})
+	conn := &fakeConn{headers: true, handler: handler}
+	tx, errs := withTransaction(t, func(ctx context.Context) {
+		reply, err := apmnats.Request(ctx, conn, "subject", []byte("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, "reply", string(reply.Data))
+
+		conn.err = errors.New("timeout")
+		_, err = apmnats.Request(ctx, conn, "subject", []byte("hello"))
+		assert.EqualError(t, err, "timeout")
+	})
+	require.Len(t, tx.Spans, 2)
+	assert.Equal(t, "NATS REQUEST to subject", tx.Spans[0].Name)
+	assert.Equal(t, "messaging.nats.request", tx.Spans[0].Type)
+	assert.Len(t, transactions(), 1)
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, "timeout", errs[0].Exception.Message)
+	assert.Equal(t, tx.Spans[1].ID, errs[0].ParentID)
+}
+
+func TestPublishNoTransaction(t *testing.T) {
+	conn := &fakeConn{}
+	err := apmnats.Publish(context.Background(), conn, "subject", []byte("hello"))
+	require.NoError(t, err)
+	require.Len(t, conn.msgs, 1)
+	assert.Equal(t, "hello", string(conn.msgs[0].Data))
+}
+
+type fakeConn struct {
+	headers bool
+	handler nats.MsgHandler
+	msgs    []*nats.Msg
+	err     error
+}
+
+func (c *fakeConn) PublishMsg(msg *nats.Msg) error {
+	c.msgs = append(c.msgs, msg)
+	if c.err != nil {
+		return c.err
+	}
+	if c.handler != nil {
+		c.handler(&nats.Msg{Subject: msg.Subject, Header: msg.Header, Data: msg.Data})
+	}
+	return nil
+}
+
+func (c *fakeConn) RequestMsgWithContext(ctx context.Context, msg *nats.Msg) (*nats.Msg, error) {
+	if err := c.PublishMsg(msg); err != nil {
+		return nil, err
+	}
+	return &nats.Msg{Subject: "reply", Data: []byte("reply")}, nil
+}
+
+func (c *fakeConn) HeadersSupported() bool {
+	return c.headers
+}
+
+// withHandlerTracer returns h wrapped with a tracer, and a function
+// which flushes and returns the transactions reported by the tracer.
+func withHandlerTracer(t *testing.T, h apmnats.Handler) (nats.MsgHandler, func() []model.Transaction) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	return apmnats.WrapHandler(h, apmnats.WithTracer(tracer)), func() []model.Transaction {
+		defer tracer.Close()
+		tracer.Flush(nil)
+		payloads := transport.Payloads()
+		require.Len(t, payloads, 1)
+		return payloads[0].Transactions()
+	}
+}
+
+func withTransaction(t *testing.T, f func(ctx context.Context)) (model.Transaction, []*model.Error) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	f(ctx)
+
+	tx.End()
+	tracer.Flush(nil)
+	var transactions []model.Transaction
+	var errors []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			errors = append(errors, p.Errors()...)
+		}
+	}
+	require.Len(t, transactions, 1)
+	return transactions[0], errors
+}
@@ -0,0 +1,5 @@
+// Package apmnats provides support for tracing NATS publishers,
+// requesters and subscribers using github.com/nats-io/nats.go
+// (formerly github.com/nats-io/go-nats), propagating the trace
+// parent through message headers.
+package apmnats
@@ -0,0 +1,71 @@
+package apmnats
+
+import (
+	"bytes"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+)
+
+// envelopePrefix is the prefix of message data wrapped in an envelope,
+// for propagating the trace parent through servers that do not support
+// headers. The envelope mimics the encoding of NATS message headers:
+//
+//     NATS/1.0\r\nElastic-Apm-Traceparent: <trace parent>\r\n\r\n<data>
+var envelopePrefix = []byte("NATS/1.0\r\n" + apmtraceparent.Header + ": ")
+
+var envelopeTerminator = []byte("\r\n\r\n")
+
+// withTraceParent returns a copy of msg with p recorded in its headers,
+// if supported. Otherwise, if envelope is true, the copy's data is
+// wrapped in an envelope holding p, unless msg's data is already
+// wrapped. If p cannot be recorded, msg is returned unmodified.
+//
+// msg itself is never modified, so that it may safely be reused.
+func withTraceParent(msg *nats.Msg, p apmtraceparent.TraceParent, headersSupported, envelope bool) *nats.Msg {
+	if headersSupported {
+		msgCopy := *msg
+		msgCopy.Header = make(nats.Header, len(msg.Header)+1)
+		for k, v := range msg.Header {
+			msgCopy.Header[k] = v
+		}
+		msgCopy.Header.Set(apmtraceparent.Header, p.String())
+		return &msgCopy
+	}
+	if !envelope || bytes.HasPrefix(msg.Data, envelopePrefix) {
+		return msg
+	}
+	s := p.String()
+	data := make([]byte, 0, len(envelopePrefix)+len(s)+len(envelopeTerminator)+len(msg.Data))
+	data = append(data, envelopePrefix...)
+	data = append(data, s...)
+	data = append(data, envelopeTerminator...)
+	msgCopy := *msg
+	msgCopy.Data = append(data, msg.Data...)
+	return &msgCopy
+}
+
+// traceParent returns the trace parent recorded in msg's headers, or in
+// an envelope wrapping its data. If msg's data is wrapped in an envelope,
+// it is replaced with the unwrapped data.
+func traceParent(msg *nats.Msg) (apmtraceparent.TraceParent, bool) {
+	if s := msg.Header.Get(apmtraceparent.Header); s != "" {
+		p, err := apmtraceparent.Parse(s)
+		return p, err == nil
+	}
+	if !bytes.HasPrefix(msg.Data, envelopePrefix) {
+		return apmtraceparent.TraceParent{}, false
+	}
+	rest := msg.Data[len(envelopePrefix):]
+	end := bytes.Index(rest, envelopeTerminator)
+	if end < 0 {
+		return apmtraceparent.TraceParent{}, false
+	}
+	p, err := apmtraceparent.Parse(string(rest[:end]))
+	if err != nil {
+		return apmtraceparent.TraceParent{}, false
+	}
+	msg.Data = rest[end+len(envelopeTerminator):]
+	return p, true
+}
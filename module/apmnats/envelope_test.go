@@ -0,0 +1,43 @@
+package apmnats
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+	"github.com/elastic/apm-agent-go/model"
+)
+
+func TestEnvelope(t *testing.T) {
+	p := apmtraceparent.TraceParent{TransactionID: model.UUID{1}, SpanID: 2, Sampled: true}
+	orig := &nats.Msg{Data: []byte("hello")}
+	msg := withTraceParent(orig, p, false, true)
+	assert.Equal(t, "NATS/1.0\r\nElastic-Apm-Traceparent: "+p.String()+"\r\n\r\nhello", string(msg.Data))
+	assert.Equal(t, "hello", string(orig.Data))
+
+	// Data already wrapped in an envelope is not wrapped again.
+	assert.Equal(t, msg, withTraceParent(msg, p, false, true))
+
+	// Data is only wrapped in an envelope if enabled.
+	assert.Equal(t, orig, withTraceParent(orig, p, false, false))
+
+	out, ok := traceParent(msg)
+	assert.True(t, ok)
+	assert.Equal(t, p, out)
+	assert.Equal(t, "hello", string(msg.Data))
+}
+
+func TestEnvelopeInvalid(t *testing.T) {
+	for _, data := range []string{
+		"hello",
+		"NATS/1.0\r\nElastic-Apm-Traceparent: 00-01",
+		"NATS/1.0\r\nElastic-Apm-Traceparent: invalid\r\n\r\nhello",
+	} {
+		msg := &nats.Msg{Data: []byte(data)}
+		_, ok := traceParent(msg)
+		assert.False(t, ok)
+		assert.Equal(t, data, string(msg.Data))
+	}
+}
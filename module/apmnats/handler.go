@@ -0,0 +1,102 @@
+package apmnats
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+)
+
+// Handler handles a message received by a subscription.
+// The context holds the message's transaction.
+type Handler func(ctx context.Context, msg *nats.Msg)
+
+// WrapHandler returns a nats.MsgHandler which calls h for each message,
+// reporting a transaction for it.
+//
+// Transactions are named after the subscription's subject, which may
+// contain wildcards, e.g. "NATS RECEIVE from orders.*". If the message
+// carries a trace parent, recorded by PublishMsg or RequestMsg, then it
+// is recorded in the transaction's custom context under "parent". If the
+// message data is wrapped in an envelope, it is unwrapped before calling h.
+//
+// By default, the handler will trace with elasticapm.DefaultTracer, and will
+// not recover any panics. Use WithTracer to specify an alternative tracer, and
+// WithRecovery to enable panic recovery.
+func WrapHandler(h Handler, o ...Option) nats.MsgHandler {
+	opts := handlerOptions{tracer: elasticapm.DefaultTracer}
+	for _, o := range o {
+		o(&opts)
+	}
+	return func(msg *nats.Msg) {
+		p, hasParent := traceParent(msg)
+		ctx := context.Background()
+		if !opts.tracer.Active() {
+			h(ctx, msg)
+			return
+		}
+		subject := msg.Subject
+		if msg.Sub != nil {
+			subject = msg.Sub.Subject
+		}
+		tx := opts.tracer.StartTransaction("NATS RECEIVE from "+subject, "messaging")
+		ctx = elasticapm.ContextWithTransaction(ctx, tx)
+		defer tx.End()
+
+		if tx.Sampled() {
+			tx.Context.SetTag("subject", msg.Subject)
+			if msg.Sub != nil && msg.Sub.Queue != "" {
+				tx.Context.SetTag("queue", msg.Sub.Queue)
+			}
+			if hasParent {
+				apmtraceparent.SetTransactionParent(tx, p)
+			}
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				e := opts.tracer.Recovered(r, tx)
+				e.Handled = opts.recover
+				e.Send()
+				if !opts.recover {
+					panic(r)
+				}
+			}
+		}()
+		h(ctx, msg)
+	}
+}
+
+type handlerOptions struct {
+	tracer  *elasticapm.Tracer
+	recover bool
+}
+
+// Option sets options for the handler returned by WrapHandler.
+type Option func(*handlerOptions)
+
+// WithTracer returns an Option which sets t as the tracer
+// to use for tracing received messages.
+func WithTracer(t *elasticapm.Tracer) Option {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(o *handlerOptions) {
+		o.tracer = t
+	}
+}
+
+// WithRecovery returns an Option which enables panic recovery
+// in the message handler.
+//
+// The handler will report panics as errors to Elastic APM, but
+// unless this is enabled, they will still cause the subscriber to
+// be terminated. With recovery enabled, panics are discarded after
+// being reported.
+func WithRecovery() Option {
+	return func(o *handlerOptions) {
+		o.recover = true
+	}
+}
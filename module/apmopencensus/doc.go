@@ -0,0 +1,4 @@
+// Package apmopencensus provides an OpenCensus stats exporter,
+// which may be registered as an elasticapm.MetricsGatherer for
+// reporting OpenCensus view data as metrics.
+package apmopencensus
@@ -0,0 +1,178 @@
+package apmopencensus
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats/view"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+// Exporter is an OpenCensus view.Exporter which records the most
+// recently exported data for each view, and reports it as metrics
+// when gathered. Exporter implements elasticapm.MetricsGatherer.
+//
+// The Exporter must be registered with both OpenCensus and the
+// tracer, e.g.
+//
+//     exporter := apmopencensus.NewExporter()
+//     view.RegisterExporter(exporter)
+//     elasticapm.DefaultTracer.RegisterMetricsGatherer(exporter)
+//
+// Metrics are named after the views, and labeled with the views'
+// tag keys. Count aggregations are reported as counters, sum and
+// last-value aggregations as gauges, and distribution aggregations
+// as histograms, with the views' bucket boundaries. Values measured
+// in milliseconds are converted to seconds.
+//
+// OpenCensus stops exporting a view's data when the view is
+// unregistered. View data which has not been exported within the
+// expiry period, specified with WithViewExpiry, is discarded.
+type Exporter struct {
+	expiry time.Duration
+
+	mu    sync.Mutex
+	views map[string]exportedView
+}
+
+type exportedView struct {
+	data *view.Data
+	time time.Time
+}
+
+// NewExporter returns a new Exporter with the given options.
+func NewExporter(o ...Option) *Exporter {
+	e := &Exporter{
+		expiry: defaultViewExpiry,
+		views:  make(map[string]exportedView),
+	}
+	for _, o := range o {
+		o(e)
+	}
+	return e
+}
+
+// defaultViewExpiry is the default period after which view data
+// that has not been exported again is discarded. OpenCensus exports
+// view data every 10 seconds by default.
+const defaultViewExpiry = time.Minute
+
+// Option sets options for the Exporter returned by NewExporter.
+type Option func(*Exporter)
+
+// WithViewExpiry returns an Option which sets the period after which
+// view data that has not been exported again is discarded. This must
+// be greater than the OpenCensus reporting period, set with
+// view.SetReportingPeriod. The default is one minute.
+func WithViewExpiry(d time.Duration) Option {
+	return func(e *Exporter) {
+		e.expiry = d
+	}
+}
+
+// ExportView records the view data, replacing any previously
+// exported data for the same view.
+func (e *Exporter) ExportView(vd *view.Data) {
+	if vd == nil || vd.View == nil {
+		return
+	}
+	exported := vd.End
+	if exported.IsZero() {
+		exported = time.Now()
+	}
+	e.mu.Lock()
+	e.views[vd.View.Name] = exportedView{data: vd, time: exported}
+	e.mu.Unlock()
+}
+
+// GatherMetrics adds the most recently exported view data to m,
+// discarding any view data that has expired.
+func (e *Exporter) GatherMetrics(ctx context.Context, m *elasticapm.Metrics) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := time.Now()
+	for name, v := range e.views {
+		if now.Sub(v.time) > e.expiry {
+			delete(e.views, name)
+			continue
+		}
+		vd := v.data
+		unit, scale := "", 1.0
+		if vd.View.Measure != nil {
+			unit, scale = convertUnit(vd.View.Measure.Unit())
+		}
+		for _, row := range vd.Rows {
+			labels := makeLabels(row)
+			switch data := row.Data.(type) {
+			case *view.CountData:
+				m.AddCounter(name, "", labels, float64(data.Value))
+			case *view.SumData:
+				// Sums may decrease if negative values
+				// are recorded, hence we report them as gauges.
+				m.AddGauge(name, unit, labels, data.Value*scale)
+			case *view.LastValueData:
+				m.AddGauge(name, unit, labels, data.Value*scale)
+			case *view.DistributionData:
+				m.AddHistogram(name, unit, labels, makeHistogram(vd.View.Aggregation, data, scale))
+			}
+		}
+	}
+	return nil
+}
+
+// makeHistogram returns a HistogramMetric for the distribution data,
+// with the bucket boundaries of the aggregation multiplied by scale.
+// OpenCensus records non-cumulative bucket counts, with an additional
+// final bucket for values exceeding the last boundary.
+func makeHistogram(agg *view.Aggregation, data *view.DistributionData, scale float64) elasticapm.HistogramMetric {
+	histogram := elasticapm.HistogramMetric{
+		Count: uint64(data.Count),
+		Sum:   data.Sum() * scale,
+	}
+	if agg == nil || len(agg.Buckets) == 0 {
+		return histogram
+	}
+	histogram.Buckets = make(map[float64]uint64, len(agg.Buckets))
+	var cumulative uint64
+	for i, bound := range agg.Buckets {
+		if i < len(data.CountPerBucket) {
+			cumulative += uint64(data.CountPerBucket[i])
+		}
+		histogram.Buckets[bound*scale] = cumulative
+	}
+	return histogram
+}
+
+func makeLabels(row *view.Row) []elasticapm.MetricLabel {
+	if len(row.Tags) == 0 {
+		return nil
+	}
+	labels := make([]elasticapm.MetricLabel, len(row.Tags))
+	for i, tag := range row.Tags {
+		labels[i] = elasticapm.MetricLabel{Name: tag.Key.Name(), Value: tag.Value}
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels
+}
+
+// convertUnit converts an OpenCensus measure unit to the equivalent
+// unit used by the agent, returning the factor by which values must
+// be multiplied.
+func convertUnit(unit string) (string, float64) {
+	switch unit {
+	case "1", "":
+		return "", 1
+	case "By":
+		return "byte", 1
+	case "s":
+		return "sec", 1
+	case "ms":
+		return "sec", 1e-3
+	}
+	return unit, 1
+}
@@ -0,0 +1,147 @@
+package apmopencensus_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmopencensus"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestExporter(t *testing.T) {
+	method := tag.MustNewKey("method")
+	status := tag.MustNewKey("status")
+	requestBytes := stats.Int64("request_bytes", "request size", stats.UnitBytes)
+	latency := stats.Float64("latency", "request latency", stats.UnitMilliseconds)
+
+	e := apmopencensus.NewExporter()
+	e.ExportView(&view.Data{
+		View: &view.View{Name: "requests", Measure: requestBytes, Aggregation: view.Count()},
+		Rows: []*view.Row{{
+			Tags: []tag.Tag{{Key: status, Value: "200"}, {Key: method, Value: "GET"}},
+			Data: &view.CountData{Value: 3},
+		}},
+	})
+	e.ExportView(&view.Data{
+		View: &view.View{Name: "request_bytes", Measure: requestBytes, Aggregation: view.Sum()},
+		Rows: []*view.Row{{Data: &view.SumData{Value: 1024}}},
+	})
+	e.ExportView(&view.Data{
+		View: &view.View{Name: "last_request_bytes", Measure: requestBytes, Aggregation: view.LastValue()},
+		Rows: []*view.Row{{Data: &view.LastValueData{Value: 256}}},
+	})
+	e.ExportView(&view.Data{
+		View: &view.View{Name: "latency", Measure: latency, Aggregation: view.Distribution(10, 100)},
+		Rows: []*view.Row{{
+			Tags: []tag.Tag{{Key: method, Value: "GET"}},
+			Data: &view.DistributionData{
+				Count:           2,
+				Min:             5,
+				Max:             15,
+				Mean:            10,
+				SumOfSquaredDev: 50,
+				CountPerBucket:  []int64{1, 1, 0},
+			},
+		}},
+	})
+
+	metrics := gatherMetrics(e)
+	require.Len(t, metrics, 3)
+
+	assert.Equal(t, model.Metric{
+		Type:  "gauge",
+		Unit:  "byte",
+		Value: newFloat64(1024),
+	}, metrics[0].Samples["request_bytes"])
+	assert.Equal(t, model.Metric{
+		Type:  "gauge",
+		Unit:  "byte",
+		Value: newFloat64(256),
+	}, metrics[0].Samples["last_request_bytes"])
+
+	assert.Equal(t, model.StringMap{{Key: "method", Value: "GET"}}, metrics[1].Labels)
+	assert.Equal(t, map[string]model.Metric{
+		"latency": {
+			Type:  "histogram",
+			Unit:  "sec",
+			Count: newUint64(2),
+			Sum:   newFloat64(0.02),
+			Buckets: []model.HistogramBucket{
+				{UpperBound: 0.01, Count: 1},
+				{UpperBound: 0.1, Count: 2},
+			},
+		},
+	}, metrics[1].Samples)
+
+	assert.Equal(t, model.StringMap{
+		{Key: "method", Value: "GET"},
+		{Key: "status", Value: "200"},
+	}, metrics[2].Labels)
+	assert.Equal(t, map[string]model.Metric{
+		"requests": {Type: "counter", Value: newFloat64(3)},
+	}, metrics[2].Samples)
+}
+
+func TestExporterReplacesViewData(t *testing.T) {
+	measure := stats.Int64("requests", "", stats.UnitDimensionless)
+	v := &view.View{Name: "requests", Measure: measure, Aggregation: view.Count()}
+
+	e := apmopencensus.NewExporter()
+	e.ExportView(&view.Data{View: v, Rows: []*view.Row{{Data: &view.CountData{Value: 1}}}})
+	e.ExportView(&view.Data{View: v, Rows: []*view.Row{{Data: &view.CountData{Value: 2}}}})
+
+	metrics := gatherMetrics(e)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, model.Metric{Type: "counter", Value: newFloat64(2)}, metrics[0].Samples["requests"])
+}
+
+func TestExporterViewExpiry(t *testing.T) {
+	measure := stats.Int64("requests", "", stats.UnitDimensionless)
+	current := &view.View{Name: "current", Measure: measure, Aggregation: view.Count()}
+	stale := &view.View{Name: "stale", Measure: measure, Aggregation: view.Count()}
+
+	e := apmopencensus.NewExporter(apmopencensus.WithViewExpiry(time.Minute))
+	e.ExportView(&view.Data{
+		View: current,
+		End:  time.Now(),
+		Rows: []*view.Row{{Data: &view.CountData{Value: 1}}},
+	})
+	e.ExportView(&view.Data{
+		View: stale,
+		End:  time.Now().Add(-2 * time.Minute),
+		Rows: []*view.Row{{Data: &view.CountData{Value: 1}}},
+	})
+
+	metrics := gatherMetrics(e)
+	require.Len(t, metrics, 1)
+	assert.Contains(t, metrics[0].Samples, "current")
+	assert.NotContains(t, metrics[0].Samples, "stale")
+}
+
+func gatherMetrics(g elasticapm.MetricsGatherer) []*model.Metrics {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.RegisterMetricsGatherer(g)
+	tracer.SendMetrics(nil)
+	metrics := transport.Payloads()[0].Metrics()
+	for _, m := range metrics {
+		m.Timestamp = model.Time{}
+	}
+	return metrics
+}
+
+func newUint64(v uint64) *uint64 {
+	return &v
+}
+
+func newFloat64(v float64) *float64 {
+	return &v
+}
@@ -64,8 +64,19 @@ func (g gatherer) GatherMetrics(ctx context.Context, out *elasticapm.Metrics) er
 					Quantiles: quantiles,
 				})
 			}
-		default:
-			// TODO(axw) MetricType_HISTOGRAM
+		case dto.MetricType_HISTOGRAM:
+			for _, m := range mf.GetMetric() {
+				h := m.GetHistogram()
+				buckets := make(map[float64]uint64)
+				for _, b := range h.GetBucket() {
+					buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+				}
+				out.AddHistogram(name, "", makeLabels(m.GetLabel()), elasticapm.HistogramMetric{
+					Count:   h.GetSampleCount(),
+					Sum:     h.GetSampleSum(),
+					Buckets: buckets,
+				})
+			}
 		}
 	}
 	return nil
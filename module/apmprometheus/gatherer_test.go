@@ -53,6 +53,35 @@ func TestSummary(t *testing.T) {
 	}, metrics[0].Samples["summary"])
 }
 
+func TestHistogram(t *testing.T) {
+	r := prometheus.NewRegistry()
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "histogram",
+		Help:    "halp",
+		Buckets: []float64{0.1, 1, 10},
+	})
+	r.MustRegister(h)
+
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(0.5)
+	h.Observe(20)
+
+	g := apmprometheus.Wrap(r)
+	metrics := gatherMetrics(g)
+	assert.Contains(t, metrics[0].Samples, "histogram")
+	assert.Equal(t, model.Metric{
+		Type:  "histogram",
+		Count: newUint64(4),
+		Sum:   newFloat64(21.05),
+		Buckets: []model.HistogramBucket{
+			{UpperBound: 0.1, Count: 1},
+			{UpperBound: 1, Count: 3},
+			{UpperBound: 10, Count: 3},
+		},
+	}, metrics[0].Samples["histogram"])
+}
+
 func TestLabels(t *testing.T) {
 	r := prometheus.NewRegistry()
 	httpReqsTotal := prometheus.NewCounterVec(
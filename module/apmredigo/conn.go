@@ -0,0 +1,202 @@
+package apmredigo
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmredisutil"
+)
+
+// Conn is the interface returned by Wrap.
+//
+// Conn implements redis.ConnWithTimeout and redis.ConnWithContext.
+type Conn interface {
+	redis.ConnWithTimeout
+	redis.ConnWithContext
+
+	// WithContext returns a shallow copy of the connection with
+	// its context changed to ctx.
+	//
+	// To report commands as spans, ctx must contain a transaction
+	// or span.
+	WithContext(ctx context.Context) Conn
+}
+
+// Wrap wraps conn such that its commands are reported as spans to
+// Elastic APM, using the context provided with Conn.WithContext, or
+// the context passed to DoContext or ReceiveContext.
+//
+// Spans are reported for each call to Do, Flush, and Receive. Commands
+// queued with Send are reported as a single span when Flush is called.
+func Wrap(conn redis.Conn, o ...Option) Conn {
+	if conn, ok := conn.(contextConn); ok {
+		return conn
+	}
+	cfg := &connConfig{}
+	for _, o := range o {
+		o(cfg)
+	}
+	return contextConn{Conn: conn, ctx: context.Background(), cfg: cfg, pending: new([]pendingCommand)}
+}
+
+// Do calls conn.Do(commandName, args...), reporting the command
+// as a span within the transaction and span in ctx, if any.
+func Do(ctx context.Context, conn redis.Conn, commandName string, args ...interface{}) (interface{}, error) {
+	return Wrap(conn).WithContext(ctx).Do(commandName, args...)
+}
+
+// DoWithTimeout calls redis.DoWithTimeout(conn, timeout, commandName, args...),
+// reporting the command as a span within the transaction and span in
+// ctx, if any.
+func DoWithTimeout(ctx context.Context, conn redis.Conn, timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	return Wrap(conn).WithContext(ctx).DoWithTimeout(timeout, commandName, args...)
+}
+
+type contextConn struct {
+	redis.Conn
+	ctx context.Context
+	cfg *connConfig
+
+	// pending holds the commands queued with Send,
+	// which have not yet been flushed. It is shared
+	// by the copies returned by WithContext.
+	pending *[]pendingCommand
+}
+
+type pendingCommand struct {
+	name string
+	args []interface{}
+}
+
+func (c contextConn) WithContext(ctx context.Context) Conn {
+	c.ctx = ctx
+	return c
+}
+
+// Do calls the wrapped connection's Do method, reporting a span for
+// the command. If commandName is empty, pending commands are flushed
+// and their replies received, and the span is named "(flush)".
+func (c contextConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return c.do(c.ctx, commandName, args, func() (interface{}, error) {
+		return c.Conn.Do(commandName, args...)
+	})
+}
+
+// DoWithTimeout calls redis.DoWithTimeout with the wrapped
+// connection, reporting a span for the command.
+func (c contextConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	return c.do(c.ctx, commandName, args, func() (interface{}, error) {
+		return redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+	})
+}
+
+// DoContext calls redis.DoContext with the wrapped connection,
+// reporting a span for the command within the transaction and
+// span in ctx, if any.
+func (c contextConn) DoContext(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	return c.do(ctx, commandName, args, func() (interface{}, error) {
+		return redis.DoContext(c.Conn, ctx, commandName, args...)
+	})
+}
+
+func (c contextConn) do(ctx context.Context, commandName string, args []interface{}, do func() (interface{}, error)) (interface{}, error) {
+	if commandName == "" {
+		c.clearPending()
+		span, ctx := c.startSpan(ctx, "(flush)", "db.redis.flush", "")
+		reply, err := do()
+		finishSpan(ctx, span, err)
+		return reply, err
+	}
+	var statement string
+	if c.cfg.statements {
+		statement = apmredisutil.FormatStatement(commandName, args)
+	}
+	span, ctx := c.startSpan(ctx, strings.ToUpper(commandName), "db.redis."+strings.ToLower(commandName), statement)
+	reply, err := do()
+	finishSpan(ctx, span, err)
+	return reply, err
+}
+
+// Send calls the wrapped connection's Send method. The command
+// is reported when the connection is flushed.
+func (c contextConn) Send(commandName string, args ...interface{}) error {
+	if err := c.Conn.Send(commandName, args...); err != nil {
+		return err
+	}
+	*c.pending = append(*c.pending, pendingCommand{name: commandName, args: args})
+	return nil
+}
+
+// Flush calls the wrapped connection's Flush method, reporting
+// the commands queued with Send as a span named "(pipeline)".
+func (c contextConn) Flush() error {
+	var statement string
+	if c.cfg.statements {
+		statements := make([]string, len(*c.pending))
+		for i, cmd := range *c.pending {
+			statements[i] = apmredisutil.FormatStatement(cmd.name, cmd.args)
+		}
+		statement = strings.Join(statements, "\n")
+	}
+	c.clearPending()
+	span, ctx := c.startSpan(c.ctx, "(pipeline)", "db.redis.pipeline", statement)
+	err := c.Conn.Flush()
+	finishSpan(ctx, span, err)
+	return err
+}
+
+// Receive calls the wrapped connection's Receive method,
+// reporting a span named "(receive)".
+func (c contextConn) Receive() (interface{}, error) {
+	return c.receive(c.ctx, c.Conn.Receive)
+}
+
+// ReceiveWithTimeout calls redis.ReceiveWithTimeout with the
+// wrapped connection, reporting a span named "(receive)".
+func (c contextConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.receive(c.ctx, func() (interface{}, error) {
+		return redis.ReceiveWithTimeout(c.Conn, timeout)
+	})
+}
+
+// ReceiveContext calls redis.ReceiveContext with the wrapped
+// connection, reporting a span named "(receive)" within the
+// transaction and span in ctx, if any.
+func (c contextConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	return c.receive(ctx, func() (interface{}, error) {
+		return redis.ReceiveContext(c.Conn, ctx)
+	})
+}
+
+func (c contextConn) receive(ctx context.Context, receive func() (interface{}, error)) (interface{}, error) {
+	span, ctx := c.startSpan(ctx, "(receive)", "db.redis.receive", "")
+	reply, err := receive()
+	finishSpan(ctx, span, err)
+	return reply, err
+}
+
+func (c contextConn) clearPending() {
+	*c.pending = (*c.pending)[:0]
+}
+
+func (c contextConn) startSpan(ctx context.Context, name, spanType, statement string) (*elasticapm.Span, context.Context) {
+	span, ctx := elasticapm.StartSpan(ctx, name, spanType)
+	if !span.Dropped() {
+		span.Context.SetDatabase(elasticapm.DatabaseSpanContext{
+			Statement: apmredisutil.Truncate(statement),
+			Type:      "redis",
+		})
+	}
+	return span, ctx
+}
+
+func finishSpan(ctx context.Context, span *elasticapm.Span, err error) {
+	span.End()
+	if e := elasticapm.CaptureError(ctx, err); e != nil {
+		e.Send()
+	}
+}
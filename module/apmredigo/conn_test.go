@@ -0,0 +1,166 @@
+package apmredigo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmredigo"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestDo(t *testing.T) {
+	conn, closeConn := dial(t)
+	defer closeConn()
+
+	tx, errors := withTransaction(t, func(ctx context.Context) {
+		conn := apmredigo.Wrap(conn).WithContext(ctx)
+		_, err := conn.Do("SET", "key", "value")
+		require.NoError(t, err)
+		_, err = apmredigo.Do(ctx, conn, "get", "key")
+		require.NoError(t, err)
+		_, err = apmredigo.DoWithTimeout(ctx, conn, time.Second, "GET", "key")
+		require.NoError(t, err)
+	})
+	require.Len(t, tx.Spans, 3)
+	assert.Equal(t, "SET", tx.Spans[0].Name)
+	assert.Equal(t, "db.redis.set", tx.Spans[0].Type)
+	assert.Equal(t, &model.SpanContext{
+		Database: &model.DatabaseSpanContext{Type: "redis"},
+	}, tx.Spans[0].Context)
+	assert.Equal(t, "GET", tx.Spans[1].Name)
+	assert.Equal(t, "db.redis.get", tx.Spans[1].Type)
+	assert.Equal(t, "GET", tx.Spans[2].Name)
+	assert.Empty(t, errors)
+}
+
+func TestDoContext(t *testing.T) {
+	conn, closeConn := dial(t)
+	defer closeConn()
+
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		// The connection's context has no transaction,
+		// but the one passed to DoContext does.
+		conn := apmredigo.Wrap(conn, apmredigo.WithStatements())
+		_, err := redis.DoContext(conn, ctx, "SET", "key", "value")
+		require.NoError(t, err)
+		_, err = conn.Do("GET", "key")
+		require.NoError(t, err)
+	})
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, "SET", tx.Spans[0].Name)
+	assert.Equal(t, "SET key ?", tx.Spans[0].Context.Database.Statement)
+}
+
+func TestDoError(t *testing.T) {
+	conn, closeConn := dial(t)
+	defer closeConn()
+
+	tx, errors := withTransaction(t, func(ctx context.Context) {
+		conn := apmredigo.Wrap(conn).WithContext(ctx)
+		_, err := conn.Do("SET", "key", "value")
+		require.NoError(t, err)
+		_, err = conn.Do("INCR", "key")
+		require.Error(t, err)
+	})
+	require.Len(t, tx.Spans, 2)
+	require.Len(t, errors, 1)
+	assert.Equal(t, tx.ID, errors[0].Transaction.ID)
+	assert.Equal(t, tx.Spans[1].ID, errors[0].ParentID)
+}
+
+func TestSendFlushReceive(t *testing.T) {
+	conn, closeConn := dial(t)
+	defer closeConn()
+
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		conn := apmredigo.Wrap(conn, apmredigo.WithStatements()).WithContext(ctx)
+		require.NoError(t, conn.Send("SET", "key", "value"))
+		require.NoError(t, conn.Send("GET", "key"))
+		require.NoError(t, conn.Flush())
+		_, err := conn.Receive()
+		require.NoError(t, err)
+		reply, err := redis.String(conn.Receive())
+		require.NoError(t, err)
+		assert.Equal(t, "value", reply)
+
+		require.NoError(t, conn.Send("GET", "key"))
+		_, err = conn.Do("")
+		require.NoError(t, err)
+	})
+	require.Len(t, tx.Spans, 4)
+	assert.Equal(t, "(pipeline)", tx.Spans[0].Name)
+	assert.Equal(t, "db.redis.pipeline", tx.Spans[0].Type)
+	assert.Equal(t, "SET key ?\nGET key", tx.Spans[0].Context.Database.Statement)
+	assert.Equal(t, "(receive)", tx.Spans[1].Name)
+	assert.Equal(t, "db.redis.receive", tx.Spans[1].Type)
+	assert.Equal(t, "(receive)", tx.Spans[2].Name)
+	assert.Equal(t, "(flush)", tx.Spans[3].Name)
+	assert.Equal(t, "db.redis.flush", tx.Spans[3].Type)
+}
+
+func TestGetContext(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		},
+	}
+	defer pool.Close()
+
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		conn, err := apmredigo.GetContext(ctx, pool)
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Do("PING")
+		require.NoError(t, err)
+	})
+	require.Len(t, tx.Spans, 2)
+	assert.Equal(t, "(pool wait)", tx.Spans[0].Name)
+	assert.Equal(t, "db.redis.pool", tx.Spans[0].Type)
+	assert.Equal(t, "PING", tx.Spans[1].Name)
+}
+
+func dial(t *testing.T) (redis.Conn, func()) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	conn, err := redis.Dial("tcp", s.Addr())
+	require.NoError(t, err)
+	return conn, func() {
+		conn.Close()
+		s.Close()
+	}
+}
+
+func withTransaction(t *testing.T, f func(ctx context.Context)) (model.Transaction, []*model.Error) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	f(ctx)
+
+	tx.End()
+	tracer.Flush(nil)
+	var transactions []model.Transaction
+	var errors []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			errors = append(errors, p.Errors()...)
+		}
+	}
+	require.Len(t, transactions, 1)
+	return transactions[0], errors
+}
@@ -0,0 +1,3 @@
+// Package apmredigo provides helpers for tracing github.com/gomodule/redigo/redis
+// client operations as spans.
+package apmredigo
@@ -0,0 +1,19 @@
+package apmredigo
+
+// Option sets options for the connection returned by Wrap.
+type Option func(*connConfig)
+
+type connConfig struct {
+	statements bool
+}
+
+// WithStatements returns an Option which causes commands to be
+// recorded as span statements. Statements are sanitized: only the
+// command name and its first argument, which is usually the key,
+// are recorded; all other arguments are replaced with "?". Long
+// statements are truncated.
+func WithStatements() Option {
+	return func(cfg *connConfig) {
+		cfg.statements = true
+	}
+}
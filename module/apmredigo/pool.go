@@ -0,0 +1,26 @@
+package apmredigo
+
+import (
+	"context"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+// GetContext gets a connection from pool with pool.GetContext, and
+// returns it wrapped with Wrap, using ctx as the connection's context.
+//
+// The time spent obtaining the connection, including any time waiting
+// for a connection to become available if pool.Wait is true, is reported
+// as a span named "(pool wait)" within the transaction and span in ctx,
+// if any.
+func GetContext(ctx context.Context, pool *redis.Pool, o ...Option) (Conn, error) {
+	span, spanCtx := elasticapm.StartSpan(ctx, "(pool wait)", "db.redis.pool")
+	conn, err := pool.GetContext(ctx)
+	finishSpan(spanCtx, span, err)
+	if err != nil {
+		return nil, err
+	}
+	return Wrap(conn, o...).WithContext(ctx), nil
+}
@@ -0,0 +1,204 @@
+package apmrpc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmrpc"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Arith struct{}
+
+func (Arith) Multiply(args *Args, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func (Arith) Divide(args *Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func TestClientServer(t *testing.T) {
+	serverTracer, serverTransport := transporttest.NewRecorderTracer()
+	defer serverTracer.Close()
+
+	server := rpc.NewServer()
+	require.NoError(t, server.Register(Arith{}))
+	clientConn, serverConn := net.Pipe()
+	go apmrpc.ServeConn(server, serverConn, apmrpc.WithTracer(serverTracer))
+
+	client := apmrpc.NewClient(clientConn, apmrpc.WithPropagation())
+	defer client.Close()
+
+	tx, errs := withTransaction(t, func(ctx context.Context) {
+		var reply int
+		require.NoError(t, apmrpc.Call(ctx, client, "Arith.Multiply", &Args{A: 6, B: 7}, &reply))
+		assert.Equal(t, 42, reply)
+		assert.EqualError(t, apmrpc.Call(ctx, client, "Arith.Divide", &Args{A: 1}, &reply), "divide by zero")
+
+		// Calls made directly with the client are not traced.
+		require.NoError(t, client.Call("Arith.Multiply", &Args{A: 2, B: 3}, &reply))
+		assert.Equal(t, 6, reply)
+	})
+	require.Len(t, tx.Spans, 2)
+	assert.Equal(t, "Arith.Multiply", tx.Spans[0].Name)
+	assert.Equal(t, "rpc", tx.Spans[0].Type)
+	assert.Equal(t, "Arith.Divide", tx.Spans[1].Name)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "divide by zero", errs[0].Exception.Message)
+	assert.Equal(t, tx.Spans[1].ID, errs[0].ParentID)
+
+	serverTracer.Flush(nil)
+	var serverTransactions []model.Transaction
+	var serverErrors []*model.Error
+	for _, p := range serverTransport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			serverTransactions = append(serverTransactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			serverErrors = append(serverErrors, p.Errors()...)
+		}
+	}
+	require.Len(t, serverTransactions, 3)
+	assert.Equal(t, "Arith.Multiply", serverTransactions[0].Name)
+	assert.Equal(t, "rpc", serverTransactions[0].Type)
+	assert.Equal(t, "success", serverTransactions[0].Result)
+	assert.Equal(t, "Arith.Divide", serverTransactions[1].Name)
+	assert.Equal(t, "error", serverTransactions[1].Result)
+	assert.Equal(t, "Arith.Multiply", serverTransactions[2].Name)
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, model.IfaceMap{{
+			Key: "parent",
+			Value: map[string]interface{}{
+				"transaction_id": tx.ID.String(),
+				"span_id":        float64(*tx.Spans[i].ID),
+			},
+		}}, serverTransactions[i].Context.Custom)
+	}
+	assert.Nil(t, serverTransactions[2].Context)
+
+	require.Len(t, serverErrors, 1)
+	assert.Equal(t, "divide by zero", serverErrors[0].Exception.Message)
+	assert.Equal(t, serverTransactions[1].ID, serverErrors[0].Transaction.ID)
+}
+
+func TestWrapCodecs(t *testing.T) {
+	serverTracer, serverTransport := transporttest.NewRecorderTracer()
+	defer serverTracer.Close()
+
+	server := rpc.NewServer()
+	require.NoError(t, server.Register(Arith{}))
+	clientConn, serverConn := net.Pipe()
+	go server.ServeCodec(apmrpc.WrapServerCodec(jsonrpc.NewServerCodec(serverConn), apmrpc.WithTracer(serverTracer)))
+
+	client := apmrpc.NewClientWithCodec(jsonrpc.NewClientCodec(clientConn), apmrpc.WithPropagation())
+	defer client.Close()
+
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		var reply int
+		require.NoError(t, apmrpc.Call(ctx, client, "Arith.Multiply", &Args{A: 6, B: 7}, &reply))
+		assert.Equal(t, 42, reply)
+	})
+	require.Len(t, tx.Spans, 1)
+
+	serverTracer.Flush(nil)
+	serverTransactions := serverTransport.Payloads()[0].Transactions()
+	require.Len(t, serverTransactions, 1)
+	assert.Equal(t, "Arith.Multiply", serverTransactions[0].Name)
+	assert.NotNil(t, serverTransactions[0].Context.Custom)
+}
+
+func TestClientUnwrappedServer(t *testing.T) {
+	server := rpc.NewServer()
+	require.NoError(t, server.Register(Arith{}))
+	clientConn, serverConn := net.Pipe()
+	go server.ServeConn(serverConn)
+
+	// Without WithPropagation, the service method
+	// is unmodified, so the server need not be wrapped.
+	client := apmrpc.NewClient(clientConn)
+	defer client.Close()
+
+	tx, errs := withTransaction(t, func(ctx context.Context) {
+		for i := 0; i < 2; i++ {
+			var reply int
+			require.NoError(t, apmrpc.Call(ctx, client, "Arith.Multiply", &Args{A: 6, B: 7}, &reply))
+			assert.Equal(t, 42, reply)
+		}
+	})
+	require.Len(t, tx.Spans, 2)
+	assert.Equal(t, "Arith.Multiply", tx.Spans[0].Name)
+	assert.Empty(t, errs)
+}
+
+func TestClientConnectionClosed(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		// Read the request, and then close the
+		// connection without sending a response.
+		var req rpc.Request
+		codec := jsonrpc.NewServerCodec(serverConn)
+		if codec.ReadRequestHeader(&req) == nil {
+			codec.ReadRequestBody(nil)
+		}
+		serverConn.Close()
+	}()
+
+	client := apmrpc.NewClientWithCodec(jsonrpc.NewClientCodec(clientConn))
+	defer client.Close()
+
+	tx, errs := withTransaction(t, func(ctx context.Context) {
+		var reply int
+		err := apmrpc.Call(ctx, client, "Arith.Multiply", &Args{A: 6, B: 7}, &reply)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	})
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, "Arith.Multiply", tx.Spans[0].Name)
+	require.Len(t, errs, 1)
+	assert.Equal(t, io.ErrUnexpectedEOF.Error(), errs[0].Exception.Message)
+	assert.Equal(t, tx.Spans[0].ID, errs[0].ParentID)
+}
+
+func withTransaction(t *testing.T, f func(ctx context.Context)) (model.Transaction, []*model.Error) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	f(ctx)
+
+	tx.End()
+	tracer.Flush(nil)
+	var transactions []model.Transaction
+	var errors []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			errors = append(errors, p.Errors()...)
+		}
+	}
+	require.Len(t, transactions, 1)
+	return transactions[0], errors
+}
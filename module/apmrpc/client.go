@@ -0,0 +1,213 @@
+package apmrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/rpc"
+	"sync"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+)
+
+// Client is an rpc.Client whose codec is wrapped such that calls made
+// with Call are reported as spans. Calls made directly with the
+// embedded rpc.Client's Call and Go methods are passed through
+// without being traced.
+type Client struct {
+	*rpc.Client
+}
+
+// NewClient returns a new Client, as for rpc.NewClient,
+// using the gob codec with the given options.
+func NewClient(conn io.ReadWriteCloser, o ...ClientOption) *Client {
+	return NewClientWithCodec(newGobClientCodec(conn), o...)
+}
+
+// NewClientWithCodec returns a new Client, as for rpc.NewClientWithCodec,
+// wrapping codec with the given options. This may be used for clients
+// using codecs other than gob, such as net/rpc/jsonrpc.
+//
+// By default, the trace parent is not propagated to the server. Use
+// WithPropagation to propagate it in an envelope.
+func NewClientWithCodec(codec rpc.ClientCodec, o ...ClientOption) *Client {
+	return &Client{rpc.NewClientWithCodec(wrapClientCodec(codec, o...))}
+}
+
+// Call calls the named function with client, as for rpc.Client.Call,
+// reporting a span if ctx contains a sampled transaction. The context
+// is passed to the client's codec along with args, which the codec
+// unwraps.
+//
+// Spans are named after the service method, e.g. "Arith.Multiply", and
+// have the type "rpc". If the call fails, the error is also reported.
+func Call(ctx context.Context, client *Client, serviceMethod string, args, reply interface{}) error {
+	return client.Call(serviceMethod, &contextArgs{ctx: ctx, args: args}, reply)
+}
+
+// contextArgs wraps call arguments, passing the
+// context given to Call through to the client codec.
+type contextArgs struct {
+	ctx  context.Context
+	args interface{}
+}
+
+// wrapClientCodec wraps c such that calls made with Call are
+// reported as spans, and other calls are passed through.
+func wrapClientCodec(c rpc.ClientCodec, o ...ClientOption) rpc.ClientCodec {
+	codec := &clientCodec{
+		ClientCodec: c,
+		calls:       make(map[uint64]clientCall),
+	}
+	for _, o := range o {
+		o(codec)
+	}
+	return codec
+}
+
+// ClientOption sets options for client-side tracing.
+type ClientOption func(*clientCodec)
+
+// WithPropagation returns a ClientOption which enables propagating
+// the trace parent to the server in an envelope.
+//
+// net/rpc codecs encode only the service method name independently
+// of the argument types, so the envelope is carried in the request's
+// service method name. Servers which do not remove the envelope will
+// fail to find the service method, so this must only be used if the
+// server uses a codec wrapped by WrapServerCodec.
+func WithPropagation() ClientOption {
+	return func(c *clientCodec) {
+		c.propagate = true
+	}
+}
+
+type clientCodec struct {
+	rpc.ClientCodec
+	propagate bool
+
+	mu    sync.Mutex
+	calls map[uint64]clientCall
+
+	// current holds the call whose response is being read.
+	// Responses are read sequentially by the client, so this
+	// is not protected by mu.
+	current clientCall
+}
+
+type clientCall struct {
+	ctx  context.Context
+	span *elasticapm.Span
+}
+
+// WriteRequest writes r with body, starting a span if
+// body was passed to Call with a transaction context.
+func (c *clientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	args, ok := body.(*contextArgs)
+	if !ok {
+		return c.ClientCodec.WriteRequest(r, body)
+	}
+	body = args.args
+
+	tx := elasticapm.TransactionFromContext(args.ctx)
+	if tx == nil || !tx.Sampled() {
+		return c.ClientCodec.WriteRequest(r, body)
+	}
+	span := tx.StartSpan(r.ServiceMethod, "rpc", elasticapm.SpanFromContext(args.ctx))
+	if span.Dropped() {
+		span.End()
+		return c.ClientCodec.WriteRequest(r, body)
+	}
+	ctx := elasticapm.ContextWithSpan(args.ctx, span)
+
+	// Write the envelope with a copy of the request,
+	// so the client's record of the call is unaffected.
+	req := *r
+	if c.propagate {
+		if p, ok := apmtraceparent.FromContext(ctx); ok {
+			req.ServiceMethod = formatEnvelope(r.ServiceMethod, p)
+		}
+	}
+	c.mu.Lock()
+	c.calls[r.Seq] = clientCall{ctx: ctx, span: span}
+	c.mu.Unlock()
+	if err := c.ClientCodec.WriteRequest(&req, body); err != nil {
+		c.mu.Lock()
+		delete(c.calls, r.Seq)
+		c.mu.Unlock()
+		captureError(ctx, err)
+		span.End()
+		return err
+	}
+	return nil
+}
+
+// ReadResponseHeader reads the response header into r, recording
+// the call's span to be ended once the response body is read.
+//
+// If reading fails, the client stops reading responses and fails all
+// pending calls without closing the codec, so the error is reported
+// for each of them, and their spans ended.
+func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+	err := c.ClientCodec.ReadResponseHeader(r)
+	if err != nil {
+		if err == io.EOF {
+			// Be consistent with the error returned by
+			// rpc.Client for pending calls.
+			c.endCalls(io.ErrUnexpectedEOF)
+		} else {
+			c.endCalls(err)
+		}
+		return err
+	}
+	c.mu.Lock()
+	call, ok := c.calls[r.Seq]
+	if ok {
+		delete(c.calls, r.Seq)
+	}
+	c.mu.Unlock()
+	if ok && r.Error != "" {
+		captureError(call.ctx, errors.New(r.Error))
+	}
+	c.current = call
+	return nil
+}
+
+// ReadResponseBody reads the response body, and then ends
+// the call's span, if any.
+func (c *clientCodec) ReadResponseBody(body interface{}) error {
+	err := c.ClientCodec.ReadResponseBody(body)
+	if c.current.span != nil {
+		c.current.span.End()
+		c.current = clientCall{}
+	}
+	return err
+}
+
+// Close closes the underlying codec, ending the spans of
+// any calls that have not received a response.
+func (c *clientCodec) Close() error {
+	c.endCalls(nil)
+	return c.ClientCodec.Close()
+}
+
+// endCalls ends the spans of any calls that have not
+// received a response, reporting err for each if non-nil.
+func (c *clientCodec) endCalls(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for seq, call := range c.calls {
+		if err != nil {
+			captureError(call.ctx, err)
+		}
+		call.span.End()
+		delete(c.calls, seq)
+	}
+}
+
+func captureError(ctx context.Context, err error) {
+	if e := elasticapm.CaptureError(ctx, err); e != nil {
+		e.Send()
+	}
+}
@@ -0,0 +1,3 @@
+// Package apmrpc provides support for tracing net/rpc clients and
+// servers, by wrapping rpc.ClientCodec and rpc.ServerCodec.
+package apmrpc
@@ -0,0 +1,36 @@
+package apmrpc
+
+import (
+	"strings"
+
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+)
+
+// envelopeSeparator separates the service method name and the
+// trace parent in the envelope. Request headers are the only
+// part of a request that net/rpc codecs encode independently of
+// the argument types, so the trace parent is carried alongside
+// the service method name, e.g.
+//
+//     Arith.Multiply|00-0af7651916cd43dd8448eb211c80319c-0000000000000001-01
+const envelopeSeparator = "|"
+
+// formatEnvelope returns serviceMethod wrapped in an envelope with p.
+func formatEnvelope(serviceMethod string, p apmtraceparent.TraceParent) string {
+	return serviceMethod + envelopeSeparator + p.String()
+}
+
+// parseEnvelope returns the service method and trace parent in the
+// envelope s. If s is not an envelope, parseEnvelope returns s and
+// false.
+func parseEnvelope(s string) (string, apmtraceparent.TraceParent, bool) {
+	pos := strings.LastIndex(s, envelopeSeparator)
+	if pos < 0 {
+		return s, apmtraceparent.TraceParent{}, false
+	}
+	p, err := apmtraceparent.Parse(s[pos+len(envelopeSeparator):])
+	if err != nil {
+		return s, apmtraceparent.TraceParent{}, false
+	}
+	return s[:pos], p, true
+}
@@ -0,0 +1,114 @@
+package apmrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/rpc"
+	"sync"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+)
+
+// ServeConn runs server on a single connection, as for rpc.ServeConn,
+// with its gob codec wrapped by WrapServerCodec. If server is nil,
+// rpc.DefaultServer is used.
+func ServeConn(server *rpc.Server, conn io.ReadWriteCloser, o ...ServerOption) {
+	if server == nil {
+		server = rpc.DefaultServer
+	}
+	server.ServeCodec(WrapServerCodec(newGobServerCodec(conn), o...))
+}
+
+// WrapServerCodec wraps c such that each request is reported as a
+// transaction, and any envelope added by a Client created with
+// WithPropagation is removed.
+//
+// Transactions are named after the service method, e.g. "Arith.Multiply",
+// and have the type "rpc". If the request has a trace parent, it is recorded
+// in the transaction's custom context under "parent". Service methods are
+// not passed a context by net/rpc, so they cannot report spans within the
+// transaction.
+//
+// By default, the codec will trace with elasticapm.DefaultTracer.
+// Use WithTracer to specify an alternative tracer.
+func WrapServerCodec(c rpc.ServerCodec, o ...ServerOption) rpc.ServerCodec {
+	codec := &serverCodec{
+		ServerCodec:  c,
+		tracer:       elasticapm.DefaultTracer,
+		transactions: make(map[uint64]*elasticapm.Transaction),
+	}
+	for _, o := range o {
+		o(codec)
+	}
+	return codec
+}
+
+type serverCodec struct {
+	rpc.ServerCodec
+	tracer *elasticapm.Tracer
+
+	mu           sync.Mutex
+	transactions map[uint64]*elasticapm.Transaction
+}
+
+// ReadRequestHeader reads the request header into r, removing
+// any envelope and starting a transaction for the request.
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	if err := c.ServerCodec.ReadRequestHeader(r); err != nil {
+		return err
+	}
+	serviceMethod, p, hasParent := parseEnvelope(r.ServiceMethod)
+	r.ServiceMethod = serviceMethod
+	if !c.tracer.Active() {
+		return nil
+	}
+	tx := c.tracer.StartTransaction(serviceMethod, "rpc")
+	if tx.Sampled() && hasParent {
+		apmtraceparent.SetTransactionParent(tx, p)
+	}
+	c.mu.Lock()
+	c.transactions[r.Seq] = tx
+	c.mu.Unlock()
+	return nil
+}
+
+// WriteResponse ends the request's transaction, and
+// then writes the response r with body.
+func (c *serverCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	tx, ok := c.transactions[r.Seq]
+	if ok {
+		delete(c.transactions, r.Seq)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return c.ServerCodec.WriteResponse(r, body)
+	}
+	if r.Error != "" {
+		tx.Result = "error"
+		ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+		captureError(ctx, errors.New(r.Error))
+	} else {
+		tx.Result = "success"
+	}
+	// End the transaction before writing the response, so it
+	// is reported by the time the client receives the response.
+	tx.End()
+	return c.ServerCodec.WriteResponse(r, body)
+}
+
+// ServerOption sets options for server-side tracing.
+type ServerOption func(*serverCodec)
+
+// WithTracer returns a ServerOption which sets t as the tracer
+// to use for tracing server requests.
+func WithTracer(t *elasticapm.Tracer) ServerOption {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(c *serverCodec) {
+		c.tracer = t
+	}
+}
@@ -0,0 +1,149 @@
+package apmsarama
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+)
+
+// MessageHandler handles messages consumed by a consumer group.
+// Its methods are called by the sarama.ConsumerGroupHandler
+// returned by ConsumerGroupHandler.
+type MessageHandler interface {
+	// Setup is run at the beginning of a new session,
+	// as for sarama.ConsumerGroupHandler.
+	Setup(sarama.ConsumerGroupSession) error
+
+	// Cleanup is run at the end of a session,
+	// as for sarama.ConsumerGroupHandler.
+	Cleanup(sarama.ConsumerGroupSession) error
+
+	// HandleMessage handles a single message. The context holds
+	// the transaction for the message, and is cancelled when the
+	// session ends. HandleMessage is responsible for marking the
+	// message as consumed, by calling session.MarkMessage.
+	//
+	// If HandleMessage returns an error, it is reported to Elastic
+	// APM and the claim's remaining messages are not consumed.
+	HandleMessage(ctx context.Context, session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) error
+}
+
+// ConsumerGroupHandler returns a sarama.ConsumerGroupHandler which
+// consumes claims by calling h.HandleMessage for each message, reporting
+// a transaction for each one.
+//
+// Transactions are named after the topic, e.g. "Kafka RECEIVE from topic",
+// and have the type "messaging". If the message has a trace parent header,
+// recorded by a producer wrapped with WrapSyncProducer or WrapAsyncProducer,
+// then it is recorded in the transaction's custom context under "parent".
+//
+// By default, the handler will trace with elasticapm.DefaultTracer, and will
+// not recover any panics. Use WithTracer to specify an alternative tracer, and
+// WithRecovery to enable panic recovery.
+func ConsumerGroupHandler(h MessageHandler, o ...Option) sarama.ConsumerGroupHandler {
+	handler := &consumerGroupHandler{
+		MessageHandler: h,
+		tracer:         elasticapm.DefaultTracer,
+	}
+	for _, o := range o {
+		o(handler)
+	}
+	return handler
+}
+
+type consumerGroupHandler struct {
+	MessageHandler
+	tracer  *elasticapm.Tracer
+	recover bool
+}
+
+// ConsumeClaim handles each of claim's messages in turn,
+// until the messages channel is closed or an error occurs.
+func (h *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		if err := h.handleMessage(session, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *consumerGroupHandler) handleMessage(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) (err error) {
+	ctx := session.Context()
+	if !h.tracer.Active() {
+		return h.HandleMessage(ctx, session, msg)
+	}
+	tx := h.tracer.StartTransaction("Kafka RECEIVE from "+msg.Topic, "messaging")
+	ctx = elasticapm.ContextWithTransaction(ctx, tx)
+	defer tx.End()
+
+	if tx.Sampled() {
+		tx.Context.SetTag("topic", msg.Topic)
+		tx.Context.SetTag("partition", strconv.FormatInt(int64(msg.Partition), 10))
+		tx.Context.SetTag("offset", strconv.FormatInt(msg.Offset, 10))
+		for _, header := range msg.Headers {
+			if header == nil || string(header.Key) != apmtraceparent.Header {
+				continue
+			}
+			if p, err := apmtraceparent.Parse(string(header.Value)); err == nil {
+				apmtraceparent.SetTransactionParent(tx, p)
+			}
+			break
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			e := h.tracer.Recovered(r, tx)
+			e.Handled = h.recover
+			e.Send()
+			if !h.recover {
+				panic(r)
+			}
+			tx.Result = "error"
+			err = fmt.Errorf("%s", r)
+		}
+	}()
+
+	if err = h.HandleMessage(ctx, session, msg); err != nil {
+		tx.Result = "error"
+		if e := elasticapm.CaptureError(ctx, err); e != nil {
+			e.Send()
+		}
+		return err
+	}
+	tx.Result = "success"
+	return nil
+}
+
+// Option sets options for the handler returned by ConsumerGroupHandler.
+type Option func(*consumerGroupHandler)
+
+// WithTracer returns an Option which sets t as the tracer
+// to use for tracing consumed messages.
+func WithTracer(t *elasticapm.Tracer) Option {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(h *consumerGroupHandler) {
+		h.tracer = t
+	}
+}
+
+// WithRecovery returns an Option which enables panic recovery
+// in the consumer group handler.
+//
+// The handler will report panics as errors to Elastic APM, but
+// unless this is enabled, they will still cause the consumer to
+// be terminated. With recovery enabled, panics will be translated
+// to errors, ending the consumption of the claim.
+func WithRecovery() Option {
+	return func(h *consumerGroupHandler) {
+		h.recover = true
+	}
+}
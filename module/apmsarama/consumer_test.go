@@ -0,0 +1,119 @@
+package apmsarama_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmsarama"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestConsumerGroupHandler(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	parent := apmtraceparent.TraceParent{
+		TransactionID: model.UUID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:        7,
+		Sampled:       true,
+	}
+	messages := make(chan *sarama.ConsumerMessage, 2)
+	messages <- &sarama.ConsumerMessage{
+		Topic:     "topic",
+		Partition: 1,
+		Offset:    123,
+		Headers: []*sarama.RecordHeader{{
+			Key:   []byte(apmtraceparent.Header),
+			Value: []byte(parent.String()),
+		}},
+	}
+	messages <- &sarama.ConsumerMessage{Topic: "topic", Partition: 1, Offset: 124}
+	close(messages)
+
+	var handled []*sarama.ConsumerMessage
+	handler := apmsarama.ConsumerGroupHandler(messageHandlerFunc(func(
+		ctx context.Context, session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage,
+	) error {
+		handled = append(handled, msg)
+		if msg.Offset == 124 {
+			return errors.New("boom")
+		}
+		return nil
+	}), apmsarama.WithTracer(tracer))
+
+	session := &consumerGroupSession{ctx: context.Background()}
+	err := handler.ConsumeClaim(session, &consumerGroupClaim{messages: messages})
+	assert.EqualError(t, err, "boom")
+	assert.Len(t, handled, 2)
+	tracer.Flush(nil)
+
+	var transactions []model.Transaction
+	var errs []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			errs = append(errs, p.Errors()...)
+		}
+	}
+	require.Len(t, transactions, 2)
+	for _, tx := range transactions {
+		assert.Equal(t, "Kafka RECEIVE from topic", tx.Name)
+		assert.Equal(t, "messaging", tx.Type)
+	}
+	assert.Equal(t, "success", transactions[0].Result)
+	assert.Equal(t, "error", transactions[1].Result)
+	assert.Equal(t, map[string]string{
+		"topic":     "topic",
+		"partition": "1",
+		"offset":    "123",
+	}, transactions[0].Context.Tags)
+	assert.Equal(t, model.IfaceMap{{
+		Key: "parent",
+		Value: map[string]interface{}{
+			"transaction_id": parent.TransactionID.String(),
+			"span_id":        float64(7),
+		},
+	}}, transactions[0].Context.Custom)
+	assert.Nil(t, transactions[1].Context.Custom)
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, "boom", errs[0].Exception.Message)
+	assert.Equal(t, transactions[1].ID, errs[0].Transaction.ID)
+}
+
+type messageHandlerFunc func(context.Context, sarama.ConsumerGroupSession, *sarama.ConsumerMessage) error
+
+func (f messageHandlerFunc) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (f messageHandlerFunc) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+func (f messageHandlerFunc) HandleMessage(
+	ctx context.Context, session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage,
+) error {
+	return f(ctx, session, msg)
+}
+
+type consumerGroupSession struct {
+	sarama.ConsumerGroupSession
+	ctx context.Context
+}
+
+func (s *consumerGroupSession) Context() context.Context {
+	return s.ctx
+}
+
+type consumerGroupClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *consumerGroupClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
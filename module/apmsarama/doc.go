@@ -0,0 +1,4 @@
+// Package apmsarama provides support for tracing Kafka producers and
+// consumers using github.com/Shopify/sarama, propagating the trace
+// parent through record headers.
+package apmsarama
@@ -0,0 +1,191 @@
+package apmsarama
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+)
+
+// SyncProducer is a sarama.SyncProducer which reports sent messages
+// as spans, if associated with a context containing a transaction.
+type SyncProducer interface {
+	sarama.SyncProducer
+
+	// WithContext returns a shallow copy of the producer with
+	// its context changed to ctx. Messages sent with the returned
+	// producer are reported as spans, if ctx contains a transaction.
+	WithContext(ctx context.Context) SyncProducer
+}
+
+// WrapSyncProducer wraps p such that messages sent with it are reported as
+// spans to Elastic APM, and the trace parent is recorded in their headers.
+// Spans are only reported for producers associated with a context containing
+// a sampled transaction; use the WithContext method to obtain a producer
+// associated with a context.
+//
+// Record headers require Kafka 0.11 or later, and the producer's config
+// Version to be set accordingly; for earlier versions, headers are discarded
+// by sarama, and the trace parent is not propagated.
+func WrapSyncProducer(p sarama.SyncProducer) SyncProducer {
+	ctx := context.Background()
+	if sp, ok := p.(*syncProducer); ok {
+		p = sp.SyncProducer
+		ctx = sp.ctx
+	}
+	return &syncProducer{SyncProducer: p, ctx: ctx}
+}
+
+type syncProducer struct {
+	sarama.SyncProducer
+	ctx context.Context
+}
+
+// WithContext returns a shallow copy of p with its context changed to ctx.
+func (p *syncProducer) WithContext(ctx context.Context) SyncProducer {
+	if ctx == nil {
+		panic("nil context")
+	}
+	p2 := *p
+	p2.ctx = ctx
+	return &p2
+}
+
+// SendMessage sends msg, reporting a span if p's context
+// contains a transaction.
+func (p *syncProducer) SendMessage(msg *sarama.ProducerMessage) (partition int32, offset int64, err error) {
+	span := startSendSpan(p.ctx, msg.Topic)
+	if span == nil {
+		return p.SyncProducer.SendMessage(msg)
+	}
+	defer span.End()
+	injectTraceParent(elasticapm.ContextWithSpan(p.ctx, span), msg)
+	partition, offset, err = p.SyncProducer.SendMessage(msg)
+	if err != nil {
+		captureError(p.ctx, span, err)
+	}
+	return partition, offset, err
+}
+
+// SendMessages sends msgs, reporting a single span if
+// p's context contains a transaction.
+func (p *syncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	var topic string
+	for i, msg := range msgs {
+		if i > 0 && msg.Topic != topic {
+			topic = ""
+			break
+		}
+		topic = msg.Topic
+	}
+	span := startSendSpan(p.ctx, topic)
+	if span == nil {
+		return p.SyncProducer.SendMessages(msgs)
+	}
+	defer span.End()
+	ctx := elasticapm.ContextWithSpan(p.ctx, span)
+	for _, msg := range msgs {
+		injectTraceParent(ctx, msg)
+	}
+	err := p.SyncProducer.SendMessages(msgs)
+	if err != nil {
+		captureError(p.ctx, span, err)
+	}
+	return err
+}
+
+// AsyncProducer is a sarama.AsyncProducer which can report messages
+// sent to its input channel as spans.
+type AsyncProducer interface {
+	sarama.AsyncProducer
+
+	// InputContext sends msg to the producer's input channel,
+	// reporting a span if ctx contains a transaction. The span
+	// measures the time taken to enqueue the message, not the
+	// time taken for it to be acknowledged by the broker.
+	//
+	// Messages sent directly to the producer's input channel
+	// are not reported as spans.
+	InputContext(ctx context.Context, msg *sarama.ProducerMessage)
+}
+
+// WrapAsyncProducer wraps p such that messages sent to it with the
+// InputContext method are reported as spans to Elastic APM, and the
+// trace parent is recorded in their headers.
+//
+// See WrapSyncProducer for the Kafka versions supporting propagation.
+func WrapAsyncProducer(p sarama.AsyncProducer) AsyncProducer {
+	if ap, ok := p.(*asyncProducer); ok {
+		return ap
+	}
+	return &asyncProducer{p}
+}
+
+type asyncProducer struct {
+	sarama.AsyncProducer
+}
+
+// InputContext sends msg to p's input channel, reporting
+// a span if ctx contains a transaction.
+func (p *asyncProducer) InputContext(ctx context.Context, msg *sarama.ProducerMessage) {
+	span := startSendSpan(ctx, msg.Topic)
+	if span == nil {
+		p.Input() <- msg
+		return
+	}
+	defer span.End()
+	injectTraceParent(elasticapm.ContextWithSpan(ctx, span), msg)
+	p.Input() <- msg
+}
+
+// startSendSpan starts a span for sending messages to the given topic,
+// returning nil if ctx does not contain a sampled transaction, or the
+// span would be dropped.
+func startSendSpan(ctx context.Context, topic string) *elasticapm.Span {
+	tx := elasticapm.TransactionFromContext(ctx)
+	if tx == nil || !tx.Sampled() {
+		return nil
+	}
+	name := "Kafka SEND"
+	if topic != "" {
+		name += " to " + topic
+	}
+	span := tx.StartSpan(name, "messaging.kafka.send", elasticapm.SpanFromContext(ctx))
+	if span.Dropped() {
+		span.End()
+		return nil
+	}
+	if topic != "" {
+		span.Context.SetTag("topic", topic)
+	}
+	return span
+}
+
+// injectTraceParent records the trace parent identified by ctx
+// in msg's headers, replacing any existing trace parent header.
+func injectTraceParent(ctx context.Context, msg *sarama.ProducerMessage) {
+	p, ok := apmtraceparent.FromContext(ctx)
+	if !ok {
+		return
+	}
+	header := sarama.RecordHeader{
+		Key:   []byte(apmtraceparent.Header),
+		Value: []byte(p.String()),
+	}
+	for i, h := range msg.Headers {
+		if string(h.Key) == apmtraceparent.Header {
+			msg.Headers[i] = header
+			return
+		}
+	}
+	msg.Headers = append(msg.Headers, header)
+}
+
+func captureError(ctx context.Context, span *elasticapm.Span, err error) {
+	ctx = elasticapm.ContextWithSpan(ctx, span)
+	if e := elasticapm.CaptureError(ctx, err); e != nil {
+		e.Send()
+	}
+}
@@ -0,0 +1,136 @@
+package apmsarama_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/internal/apmtraceparent"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmsarama"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestSyncProducer(t *testing.T) {
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageAndSucceed()
+	mock.ExpectSendMessageAndFail(errors.New("boom"))
+	producer := apmsarama.WrapSyncProducer(mock)
+	defer producer.Close()
+
+	msg1 := &sarama.ProducerMessage{Topic: "topic", Value: sarama.StringEncoder("hello")}
+	msg2 := &sarama.ProducerMessage{Topic: "topic", Value: sarama.StringEncoder("world")}
+	tx, errs := withTransaction(t, func(ctx context.Context) {
+		_, _, err := producer.WithContext(ctx).SendMessage(msg1)
+		assert.NoError(t, err)
+		_, _, err = producer.WithContext(ctx).SendMessage(msg2)
+		assert.EqualError(t, err, "boom")
+	})
+	require.Len(t, tx.Spans, 2)
+	for _, span := range tx.Spans {
+		assert.Equal(t, "Kafka SEND to topic", span.Name)
+		assert.Equal(t, "messaging.kafka.send", span.Type)
+		assert.Equal(t, &model.SpanContext{Tags: map[string]string{"topic": "topic"}}, span.Context)
+	}
+	assertTraceParent(t, tx, *tx.Spans[0].ID, msg1)
+	assertTraceParent(t, tx, *tx.Spans[1].ID, msg2)
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, "boom", errs[0].Exception.Message)
+	assert.Equal(t, tx.Spans[1].ID, errs[0].ParentID)
+}
+
+func TestSyncProducerNoTransaction(t *testing.T) {
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageAndSucceed()
+	producer := apmsarama.WrapSyncProducer(mock)
+	defer producer.Close()
+
+	msg := &sarama.ProducerMessage{Topic: "topic", Value: sarama.StringEncoder("hello")}
+	_, _, err := producer.SendMessage(msg)
+	assert.NoError(t, err)
+	assert.Empty(t, msg.Headers)
+}
+
+func TestSyncProducerSendMessages(t *testing.T) {
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageAndSucceed()
+	mock.ExpectSendMessageAndSucceed()
+	producer := apmsarama.WrapSyncProducer(mock)
+	defer producer.Close()
+
+	msgs := []*sarama.ProducerMessage{
+		{Topic: "topic1", Value: sarama.StringEncoder("hello")},
+		{Topic: "topic2", Value: sarama.StringEncoder("world")},
+	}
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		assert.NoError(t, producer.WithContext(ctx).SendMessages(msgs))
+	})
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, "Kafka SEND", tx.Spans[0].Name)
+	assert.Nil(t, tx.Spans[0].Context)
+	for _, msg := range msgs {
+		assertTraceParent(t, tx, *tx.Spans[0].ID, msg)
+	}
+}
+
+func TestAsyncProducer(t *testing.T) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	mock := mocks.NewAsyncProducer(t, config)
+	mock.ExpectInputAndSucceed()
+	producer := apmsarama.WrapAsyncProducer(mock)
+
+	msg := &sarama.ProducerMessage{Topic: "topic", Value: sarama.StringEncoder("hello")}
+	tx, _ := withTransaction(t, func(ctx context.Context) {
+		producer.InputContext(ctx, msg)
+	})
+	assert.Equal(t, msg, <-producer.Successes())
+	require.NoError(t, producer.Close())
+
+	require.Len(t, tx.Spans, 1)
+	assert.Equal(t, "Kafka SEND to topic", tx.Spans[0].Name)
+	assertTraceParent(t, tx, *tx.Spans[0].ID, msg)
+}
+
+func assertTraceParent(t *testing.T, tx model.Transaction, spanID int64, msg *sarama.ProducerMessage) {
+	require.Len(t, msg.Headers, 1)
+	assert.Equal(t, apmtraceparent.Header, string(msg.Headers[0].Key))
+	p, err := apmtraceparent.Parse(string(msg.Headers[0].Value))
+	require.NoError(t, err)
+	assert.Equal(t, apmtraceparent.TraceParent{
+		TransactionID: tx.ID,
+		SpanID:        spanID,
+		Sampled:       true,
+	}, p)
+}
+
+func withTransaction(t *testing.T, f func(ctx context.Context)) (model.Transaction, []*model.Error) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	f(ctx)
+
+	tx.End()
+	tracer.Flush(nil)
+	var transactions []model.Transaction
+	var errors []*model.Error
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		case *model.ErrorsPayload:
+			errors = append(errors, p.Errors()...)
+		}
+	}
+	require.Len(t, transactions, 1)
+	return transactions[0], errors
+}
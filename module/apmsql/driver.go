@@ -6,12 +6,18 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 )
 
 // DriverPrefix should be used as a driver name prefix when
 // registering via sql.Register.
 const DriverPrefix = "elasticapm/"
 
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]*tracingDriver)
+)
+
 // Register registers a traced version of the given driver.
 //
 // The name and driver values should be the same as given to
@@ -20,6 +26,22 @@ const DriverPrefix = "elasticapm/"
 func Register(name string, driver driver.Driver, opts ...WrapOption) {
 	wrapped := Wrap(driver, opts...)
 	sql.Register(DriverPrefix+name, wrapped)
+	driversMu.Lock()
+	drivers[name] = wrapped.(*tracingDriver)
+	driversMu.Unlock()
+}
+
+// DriverDSNParser returns the DSNParserFunc for the driver registered
+// with the given name via Register. If there is no such driver, the
+// returned function will return a zero DSNInfo.
+func DriverDSNParser(driverName string) DSNParserFunc {
+	driversMu.RLock()
+	driver := drivers[driverName]
+	driversMu.RUnlock()
+	if driver == nil {
+		return genericDSNParser
+	}
+	return driver.dsnParser
 }
 
 // Open opens a database with the given driver and data source names,
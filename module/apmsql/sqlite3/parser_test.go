@@ -14,3 +14,9 @@ func TestParseDSN(t *testing.T) {
 	assert.Equal(t, apmsql.DSNInfo{Database: ":memory:"}, apmsqlite3.ParseDSN(":memory:"))
 	assert.Equal(t, apmsql.DSNInfo{Database: "file:test.db"}, apmsqlite3.ParseDSN("file:test.db?cache=shared&mode=memory"))
 }
+
+func TestDriverDSNParser(t *testing.T) {
+	parser := apmsql.DriverDSNParser("sqlite3")
+	assert.Equal(t, apmsql.DSNInfo{Database: "test.db"}, parser("test.db?mode=memory"))
+	assert.Equal(t, apmsql.DSNInfo{}, apmsql.DriverDSNParser("unregistered")("test.db"))
+}
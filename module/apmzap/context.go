@@ -0,0 +1,53 @@
+package apmzap
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/elastic/apm-agent-go"
+)
+
+// FieldKeyTransactionID is the field key used by WithContext
+// for recording the transaction ID.
+const FieldKeyTransactionID = "transaction.id"
+
+// WithContext returns a copy of logger with a field identifying the
+// transaction in ctx, if any, so that log records may be correlated
+// with the transaction in Elastic APM. If ctx does not contain a
+// transaction, logger is returned unmodified.
+//
+// Errors reported by Core for log records written with the returned
+// logger are associated with the transaction and span in ctx. Such
+// records must be written before the transaction is ended.
+func WithContext(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	tx := elasticapm.TransactionFromContext(ctx)
+	if tx == nil {
+		return logger
+	}
+	return logger.With(
+		zap.String(FieldKeyTransactionID, tx.ID().String()),
+		zap.Field{Key: contextFieldKey, Type: zapcore.SkipType, Interface: ctx},
+	)
+}
+
+// contextFieldKey is the key of the field added by WithContext to
+// record the context. The field has zapcore.SkipType, so it is not
+// encoded by other cores.
+const contextFieldKey = "elasticapm.context"
+
+// fieldsContext returns the context recorded by WithContext
+// in fields, if any. The most recently added context is used.
+func fieldsContext(fields []zapcore.Field) (context.Context, bool) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		f := fields[i]
+		if f.Type != zapcore.SkipType || f.Key != contextFieldKey {
+			continue
+		}
+		if ctx, ok := f.Interface.(context.Context); ok {
+			return ctx, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,111 @@
+package apmzap
+
+import (
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/stacktrace"
+)
+
+func init() {
+	stacktrace.RegisterLibraryPackage("go.uber.org/zap")
+}
+
+// Core is an implementation of zapcore.Core, reporting log records
+// of "error" level or higher as errors to Elastic APM.
+//
+// The structured fields of each log record, including those added
+// with zap.Logger.With, are recorded in the error's custom context
+// under the "fields" key.
+//
+// Core is intended to be combined with another zapcore.Core using
+// zapcore.NewTee, so that log records continue to be written to
+// their usual destination:
+//
+//     logger := zap.New(zapcore.NewTee(core, &apmzap.Core{}))
+type Core struct {
+	// Tracer is the elasticapm.Tracer to use for reporting errors.
+	// If Tracer is nil, elasticapm.DefaultTracer is used.
+	Tracer *elasticapm.Tracer
+
+	fields []zapcore.Field
+}
+
+// Enabled returns true if level is "error" or higher.
+func (*Core) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.ErrorLevel
+}
+
+// With returns a new Core with the given fields added.
+func (c *Core) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = make([]zapcore.Field, len(c.fields), len(c.fields)+len(fields))
+	copy(clone.fields, c.fields)
+	clone.fields = append(clone.fields, fields...)
+	return &clone
+}
+
+// Check checks if the entry should be logged, and adds c to checked if so.
+func (c *Core) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write reports the log entry and fields as an error to Elastic APM.
+func (c *Core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	e := c.tracer().NewErrorLog(elasticapm.ErrorLogRecord{
+		Message:    entry.Message,
+		Level:      entry.Level.String(),
+		LoggerName: entry.LoggerName,
+	})
+	if !entry.Time.IsZero() {
+		e.Timestamp = entry.Time
+	}
+	ctx, ok := fieldsContext(fields)
+	if !ok {
+		ctx, ok = fieldsContext(c.fields)
+	}
+	if ok {
+		e.Transaction = elasticapm.TransactionFromContext(ctx)
+		e.Span = elasticapm.SpanFromContext(ctx)
+	}
+	if len(c.fields) != 0 || len(fields) != 0 {
+		enc := zapcore.NewMapObjectEncoder()
+		for _, f := range c.fields {
+			f.AddTo(enc)
+		}
+		for _, f := range fields {
+			f.AddTo(enc)
+		}
+		e.Context.SetCustom("fields", enc.Fields)
+	}
+	e.SetStacktrace(1)
+	e.Send()
+	return nil
+}
+
+// Sync flushes any errors buffered by the tracer, waiting
+// at most syncFlushTimeout so that Sync does not block
+// indefinitely if the APM server is unreachable.
+func (c *Core) Sync() error {
+	abort := make(chan struct{})
+	timer := time.AfterFunc(syncFlushTimeout, func() { close(abort) })
+	defer timer.Stop()
+	c.tracer().Flush(abort)
+	return nil
+}
+
+// syncFlushTimeout is the maximum amount of time
+// Sync will wait for the tracer to flush errors.
+const syncFlushTimeout = 5 * time.Second
+
+func (c *Core) tracer() *elasticapm.Tracer {
+	if c.Tracer == nil {
+		return elasticapm.DefaultTracer
+	}
+	return c.Tracer
+}
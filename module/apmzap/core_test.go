@@ -0,0 +1,113 @@
+package apmzap_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/elastic/apm-agent-go"
+	"github.com/elastic/apm-agent-go/model"
+	"github.com/elastic/apm-agent-go/module/apmzap"
+	"github.com/elastic/apm-agent-go/transport/transporttest"
+)
+
+func TestCore(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	logger := zap.New(&apmzap.Core{Tracer: tracer}).Named("testing")
+	logger = logger.With(zap.String("region", "us-east-1"))
+	logger.Info("not reported")
+	logger.Warn("not reported either")
+	logger.Error("oh noes", zap.Int("attempt", 3))
+	require.NoError(t, logger.Sync())
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads, 1)
+	errors := payloads[0].Errors()
+	require.Len(t, errors, 1)
+
+	err0 := errors[0]
+	assert.Equal(t, "oh noes", err0.Log.Message)
+	assert.Equal(t, "error", err0.Log.Level)
+	assert.Equal(t, "testing", err0.Log.LoggerName)
+	assert.NotEmpty(t, err0.Log.Stacktrace)
+	assert.Equal(t, "TestCore", err0.Culprit)
+	require.NotNil(t, err0.Context)
+	assert.Equal(t, model.IfaceMap{{
+		Key: "fields",
+		Value: map[string]interface{}{
+			"region":  "us-east-1",
+			"attempt": float64(3),
+		},
+	}}, err0.Context.Custom)
+}
+
+func TestWithContext(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	logger := zap.New(&apmzap.Core{Tracer: tracer})
+	assert.Equal(t, logger, apmzap.WithContext(context.Background(), logger))
+
+	tx := tracer.StartTransaction("name", "type")
+	txID := tx.ID()
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	apmzap.WithContext(ctx, logger).Error("boom")
+	tx.End()
+	tracer.Flush(nil)
+
+	var errors []*model.Error
+	var transactions []model.Transaction
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.ErrorsPayload:
+			errors = append(errors, p.Errors()...)
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		}
+	}
+	require.Len(t, errors, 1)
+	require.Len(t, transactions, 1)
+	assert.Equal(t, txID, transactions[0].ID)
+	assert.Equal(t, txID, errors[0].Transaction.ID)
+	assert.Equal(t, model.IfaceMap{{
+		Key: "fields",
+		Value: map[string]interface{}{
+			apmzap.FieldKeyTransactionID: txID.String(),
+		},
+	}}, errors[0].Context.Custom)
+}
+
+func TestWithContextSpan(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	logger := zap.New(&apmzap.Core{Tracer: tracer})
+	tx := tracer.StartTransaction("name", "type")
+	ctx := elasticapm.ContextWithTransaction(context.Background(), tx)
+	span, ctx := elasticapm.StartSpan(ctx, "name", "type")
+	apmzap.WithContext(ctx, logger).Error("boom")
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	var errors []*model.Error
+	var transactions []model.Transaction
+	for _, p := range transport.Payloads() {
+		switch p.Value.(type) {
+		case *model.ErrorsPayload:
+			errors = append(errors, p.Errors()...)
+		case *model.TransactionsPayload:
+			transactions = append(transactions, p.Transactions()...)
+		}
+	}
+	require.Len(t, errors, 1)
+	require.Len(t, transactions, 1)
+	require.Len(t, transactions[0].Spans, 1)
+	assert.Equal(t, transactions[0].ID, errors[0].Transaction.ID)
+	assert.Equal(t, transactions[0].Spans[0].ID, errors[0].ParentID)
+}
@@ -0,0 +1,4 @@
+// Package apmzap provides a go.uber.org/zap/zapcore.Core
+// implementation for reporting error log records to Elastic
+// APM, and a means of adding transaction IDs to log records.
+package apmzap
@@ -34,6 +34,11 @@ func (s *sender) sendTransactions(ctx context.Context, transactions []*Transacti
 	var stacktraceOffset int
 
 	for _, tx := range transactions {
+		if tx.filtered {
+			// The transaction was dropped by a filter
+			// in a previous, failed attempt to send.
+			continue
+		}
 		s.modelTransactions = append(s.modelTransactions, model.Transaction{
 			Name:      truncateString(tx.Name),
 			Type:      truncateString(tx.Type),
@@ -66,16 +71,29 @@ func (s *sender) sendTransactions(ctx context.Context, transactions []*Transacti
 				if span.parent != -1 {
 					modelSpan.Parent = &span.parent
 				}
+				spanStacktraceOffset := len(s.modelStacktrace)
 				s.modelStacktrace = appendModelStacktraceFrames(s.modelStacktrace, span.stacktrace)
-				modelSpan.Stacktrace = s.modelStacktrace[stacktraceOffset:]
-				stacktraceOffset += len(span.stacktrace)
+				modelSpan.Stacktrace = s.modelStacktrace[spanStacktraceOffset:]
 				s.setStacktraceContext(modelSpan.Stacktrace)
 			}
 			modelTx.Spans = s.modelSpans[spanOffset:]
-			spanOffset += len(tx.spans)
 		} else {
 			modelTx.Sampled = &tx.sampled
 		}
+		if !s.filterTransaction(modelTx) {
+			tx.filtered = true
+			s.modelTransactions = s.modelTransactions[:len(s.modelTransactions)-1]
+			s.modelSpans = s.modelSpans[:spanOffset]
+			s.modelStacktrace = s.modelStacktrace[:stacktraceOffset]
+			s.stats.TransactionsFiltered++
+			continue
+		}
+		spanOffset = len(s.modelSpans)
+		stacktraceOffset = len(s.modelStacktrace)
+	}
+	if len(s.modelTransactions) == 0 {
+		// All transactions were dropped by filters.
+		return true
 	}
 
 	service := makeService(s.tracer.Service.Name, s.tracer.Service.Version, s.tracer.Service.Environment)
@@ -93,7 +111,22 @@ func (s *sender) sendTransactions(ctx context.Context, transactions []*Transacti
 		s.stats.Errors.SendTransactions++
 		return false
 	}
-	s.stats.TransactionsSent += uint64(len(transactions))
+	s.stats.TransactionsSent += uint64(len(s.modelTransactions))
+	return true
+}
+
+// filterTransaction applies the configured transaction filters
+// to tx, returning false if tx should be dropped.
+func (s *sender) filterTransaction(tx *model.Transaction) bool {
+	if len(s.cfg.transactionFilters) == 0 {
+		return true
+	}
+	event := TransactionFilterEvent{Transaction: tx}
+	for _, f := range s.cfg.transactionFilters {
+		if !f.FilterTransaction(&event) {
+			return false
+		}
+	}
 	return true
 }
 
@@ -108,9 +141,23 @@ func (s *sender) sendErrors(ctx context.Context, errors []*Error) bool {
 		Service: &service,
 		Process: s.tracer.process,
 		System:  s.tracer.system,
-		Errors:  make([]*model.Error, len(errors)),
+		Errors:  make([]*model.Error, 0, len(errors)),
 	}
-	for i, e := range errors {
+	for _, e := range errors {
+		if e.filtered {
+			// The error was dropped by a filter in
+			// a previous, failed attempt to send.
+			continue
+		}
+		if e.Span != nil && !e.Span.Dropped() {
+			if e.Transaction == nil {
+				e.Transaction = e.Span.tx
+			}
+			if e.Span.tx == e.Transaction {
+				e.parentID = e.Span.id
+				e.model.ParentID = &e.parentID
+			}
+		}
 		if e.Transaction != nil {
 			e.model.Transaction.ID = e.Transaction.id
 		}
@@ -121,7 +168,16 @@ func (s *sender) sendErrors(ctx context.Context, errors []*Error) bool {
 		e.model.Timestamp = model.Time(e.Timestamp.UTC())
 		e.model.Context = e.Context.build()
 		e.model.Exception.Handled = e.Handled
-		payload.Errors[i] = &e.model
+		if !s.filterError(e) {
+			e.filtered = true
+			s.stats.ErrorsFiltered++
+			continue
+		}
+		payload.Errors = append(payload.Errors, &e.model)
+	}
+	if len(payload.Errors) == 0 {
+		// All errors were dropped by filters.
+		return true
 	}
 	if err := s.tracer.Transport.SendErrors(ctx, &payload); err != nil {
 		if s.cfg.logger != nil {
@@ -130,7 +186,22 @@ func (s *sender) sendErrors(ctx context.Context, errors []*Error) bool {
 		s.stats.Errors.SendErrors++
 		return false
 	}
-	s.stats.ErrorsSent += uint64(len(errors))
+	s.stats.ErrorsSent += uint64(len(payload.Errors))
+	return true
+}
+
+// filterError applies the configured error filters to e,
+// returning false if e should be dropped.
+func (s *sender) filterError(e *Error) bool {
+	if len(s.cfg.errorFilters) == 0 {
+		return true
+	}
+	event := ErrorFilterEvent{Error: &e.model, Cause: e.cause}
+	for _, f := range s.cfg.errorFilters {
+		if !f.FilterError(&event) {
+			return false
+		}
+	}
 	return true
 }
 
@@ -142,6 +213,7 @@ func (s *sender) gatherMetrics(ctx context.Context, gathered chan<- struct{}) {
 	// concurrently mutated by the main tracer goroutine. Take a
 	// copy of the current config.
 	logger := s.cfg.logger
+	s.metrics.setLimits(s.cfg.maxMetricLabelSets, s.cfg.maxMetricLabelSetsPerName)
 
 	timestamp := model.Time(time.Now().UTC())
 	var group sync.WaitGroup
@@ -155,6 +227,7 @@ func (s *sender) gatherMetrics(ctx context.Context, gathered chan<- struct{}) {
 
 	go func() {
 		group.Wait()
+		s.metrics.finish()
 		for _, m := range s.metrics.metrics {
 			m.Timestamp = timestamp
 		}
@@ -95,6 +95,12 @@ func (s *Span) SetStacktrace(skip int) {
 	s.stacktrace = stacktrace.AppendStacktrace(s.stacktrace[:0], skip+1, -1)
 }
 
+// ID returns the span's ID, which is unique within its transaction.
+// The ID of a dropped span is meaningless.
+func (s *Span) ID() int64 {
+	return s.id
+}
+
 // Dropped indicates whether or not the span is dropped, meaning it will not
 // be included in any transaction. Spans are dropped by Transaction.StartSpan
 // if the transaction is nil, non-sampled, or the transaction's max spans
@@ -29,6 +29,7 @@ type DatabaseSpanContext struct {
 func (c *SpanContext) build() *model.SpanContext {
 	switch {
 	case c.model.Database != nil:
+	case c.model.Tags != nil:
 	default:
 		return nil
 	}
@@ -44,3 +45,17 @@ func (c *SpanContext) SetDatabase(db DatabaseSpanContext) {
 	c.database = model.DatabaseSpanContext(db)
 	c.model.Database = &c.database
 }
+
+// SetTag sets a tag in the span context. If the key is invalid
+// (contains '.', '*', or '"'), the call is a no-op.
+func (c *SpanContext) SetTag(key, value string) {
+	if !validTagKey(key) {
+		return
+	}
+	value = truncateString(value)
+	if c.model.Tags == nil {
+		c.model.Tags = map[string]string{key: value}
+	} else {
+		c.model.Tags[key] = value
+	}
+}
@@ -0,0 +1,268 @@
+package elasticapm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultProcfsRoot is the mount point of procfs on Linux.
+const defaultProcfsRoot = "/proc"
+
+// systemMetricsGatherer is a MetricsGatherer which gathers system and
+// process metrics from procfs:
+//   - system CPU usage (/proc/stat)
+//   - system memory (/proc/meminfo)
+//   - process CPU usage (/proc/self/stat)
+//   - process memory and threads (/proc/self/status)
+//   - process open file descriptors (/proc/self/fd)
+type systemMetricsGatherer struct {
+	// procfs holds the procfs root directory, which
+	// is overridden in tests to read from testdata.
+	procfs string
+
+	mu   sync.Mutex
+	last cpuSample
+}
+
+// cpuSample holds a sample of system and process CPU times,
+// measured in clock ticks.
+type cpuSample struct {
+	systemTotal uint64
+	systemIdle  uint64
+	process     uint64
+}
+
+func newSystemMetricsGatherer() MetricsGatherer {
+	return newProcfsMetricsGatherer(defaultProcfsRoot)
+}
+
+// newProcfsMetricsGatherer returns a new systemMetricsGatherer
+// which reads from the procfs directory rooted at procfs.
+func newProcfsMetricsGatherer(procfs string) *systemMetricsGatherer {
+	g := &systemMetricsGatherer{procfs: procfs}
+	// Take an initial CPU sample so that CPU usage
+	// can be reported on the first gathering.
+	g.last, _ = g.readCPUSample()
+	return g
+}
+
+// newConsumer returns a new systemMetricsGatherer
+// reading from the same procfs directory.
+func (g *systemMetricsGatherer) newConsumer() MetricsGatherer {
+	return newProcfsMetricsGatherer(g.procfs)
+}
+
+// GatherMetrics gathers system and process metrics into m.
+func (g *systemMetricsGatherer) GatherMetrics(ctx context.Context, m *Metrics) error {
+	var firstErr error
+	setErr := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	setErr(g.gatherCPUMetrics(m))
+	setErr(g.gatherSystemMemoryMetrics(m))
+	setErr(g.gatherProcessStatusMetrics(m))
+	setErr(g.gatherProcessFDMetrics(m))
+	return firstErr
+}
+
+func (g *systemMetricsGatherer) gatherCPUMetrics(m *Metrics) error {
+	sample, err := g.readCPUSample()
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	last := g.last
+	g.last = sample
+	g.mu.Unlock()
+
+	// Both system and process CPU usage are reported as a
+	// percentage of the total CPU time across all CPUs.
+	var systemPct, processPct float64
+	if sample.systemTotal > last.systemTotal {
+		total := float64(sample.systemTotal - last.systemTotal)
+		var idle, process float64
+		if sample.systemIdle > last.systemIdle {
+			idle = float64(sample.systemIdle - last.systemIdle)
+		}
+		if sample.process > last.process {
+			process = float64(sample.process - last.process)
+		}
+		systemPct = (1 - idle/total) * 100
+		processPct = process / total * 100
+	}
+	m.AddGauge("system.cpu.total.pct", "", nil, systemPct)
+	m.AddGauge("system.process.cpu.total.pct", "", nil, processPct)
+	return nil
+}
+
+func (g *systemMetricsGatherer) gatherSystemMemoryMetrics(m *Metrics) error {
+	fields, err := readProcfsFields(filepath.Join(g.procfs, "meminfo"))
+	if err != nil {
+		return err
+	}
+	total, err := parseKilobytes(fields["MemTotal"])
+	if err != nil {
+		return err
+	}
+	// MemAvailable (since Linux 3.14) is a better estimate
+	// of the memory available for starting new applications
+	// than MemFree, as it includes reclaimable caches.
+	freeField, ok := fields["MemAvailable"]
+	if !ok {
+		freeField = fields["MemFree"]
+	}
+	free, err := parseKilobytes(freeField)
+	if err != nil {
+		return err
+	}
+	m.AddGauge("system.memory.total", "byte", nil, float64(total))
+	m.AddGauge("system.memory.free", "byte", nil, float64(free))
+	return nil
+}
+
+func (g *systemMetricsGatherer) gatherProcessStatusMetrics(m *Metrics) error {
+	fields, err := readProcfsFields(filepath.Join(g.procfs, "self", "status"))
+	if err != nil {
+		return err
+	}
+	rss, err := parseKilobytes(fields["VmRSS"])
+	if err != nil {
+		return err
+	}
+	size, err := parseKilobytes(fields["VmSize"])
+	if err != nil {
+		return err
+	}
+	threads, err := strconv.ParseUint(fields["Threads"], 10, 64)
+	if err != nil {
+		return err
+	}
+	m.AddGauge("system.process.memory.rss", "byte", nil, float64(rss))
+	m.AddGauge("system.process.memory.size", "byte", nil, float64(size))
+	m.AddGauge("system.process.threads", "", nil, float64(threads))
+	return nil
+}
+
+func (g *systemMetricsGatherer) gatherProcessFDMetrics(m *Metrics) error {
+	f, err := os.Open(filepath.Join(g.procfs, "self", "fd"))
+	if err != nil {
+		return err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	n := len(names)
+	if g.procfs == defaultProcfsRoot {
+		// Exclude the file descriptor used for reading
+		// the live /proc/self/fd directory.
+		n--
+	}
+	m.AddGauge("system.process.fd.open", "", nil, float64(n))
+	return nil
+}
+
+// readCPUSample reads the system CPU times from /proc/stat,
+// and the process CPU times from /proc/self/stat.
+func (g *systemMetricsGatherer) readCPUSample() (cpuSample, error) {
+	var sample cpuSample
+	statPath := filepath.Join(g.procfs, "stat")
+	data, err := ioutil.ReadFile(statPath)
+	if err != nil {
+		return sample, err
+	}
+	// The first line holds the aggregate times for all CPUs:
+	//   cpu user nice system idle iowait irq softirq steal guest guest_nice
+	// guest and guest_nice are included in user and nice respectively.
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return sample, fmt.Errorf("failed to parse %s", statPath)
+	}
+	for i, field := range fields[1:] {
+		if i == 8 {
+			break
+		}
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return sample, err
+		}
+		sample.systemTotal += v
+		if i == 3 || i == 4 {
+			// idle, iowait
+			sample.systemIdle += v
+		}
+	}
+
+	selfStatPath := filepath.Join(g.procfs, "self", "stat")
+	data, err = ioutil.ReadFile(selfStatPath)
+	if err != nil {
+		return sample, err
+	}
+	// The process name (field 2) is enclosed in parentheses,
+	// and may itself contain spaces or parentheses. The fields
+	// following it start with the process state (field 3);
+	// utime and stime are fields 14 and 15.
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return sample, fmt.Errorf("failed to parse %s", selfStatPath)
+	}
+	fields = strings.Fields(string(data[i+1:]))
+	if len(fields) < 13 {
+		return sample, fmt.Errorf("failed to parse %s", selfStatPath)
+	}
+	for _, field := range fields[11:13] {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return sample, err
+		}
+		sample.process += v
+	}
+	return sample, nil
+}
+
+// readProcfsFields reads a procfs file containing "Key: value" lines,
+// such as /proc/meminfo, returning a map of keys to trimmed values.
+func readProcfsFields(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.IndexRune(line, ':')
+		if i < 0 {
+			continue
+		}
+		fields[line[:i]] = strings.TrimSpace(line[i+1:])
+	}
+	return fields, scanner.Err()
+}
+
+// parseKilobytes parses a value of the form "1234 kB",
+// returning the number of bytes.
+func parseKilobytes(s string) (uint64, error) {
+	s = strings.TrimSuffix(s, " kB")
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return v * 1024, nil
+}
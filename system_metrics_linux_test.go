@@ -0,0 +1,74 @@
+package elasticapm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemMetricsGatherer(t *testing.T) {
+	g := newProcfsMetricsGatherer(filepath.Join("testdata", "procfs", "valid"))
+	g.last = cpuSample{}
+	samples, err := gatherProcfsTestdata(g)
+	require.NoError(t, err)
+	assert.InDelta(t, 17, samples["system.cpu.total.pct"], 0.0001)
+	delete(samples, "system.cpu.total.pct")
+	assert.Equal(t, map[string]float64{
+		"system.process.cpu.total.pct": 5,
+		"system.memory.total":          2048000 * 1024,
+		"system.memory.free":           1024000 * 1024,
+		"system.process.memory.rss":    50000 * 1024,
+		"system.process.memory.size":   200000 * 1024,
+		"system.process.threads":       8,
+		"system.process.fd.open":       4,
+	}, samples)
+}
+
+func TestSystemMetricsGathererMemFree(t *testing.T) {
+	// MemAvailable is missing before Linux 3.14,
+	// in which case MemFree is reported instead.
+	g := newProcfsMetricsGatherer(filepath.Join("testdata", "procfs", "memfree"))
+	samples, err := gatherProcfsTestdata(g)
+	require.NoError(t, err)
+	assert.Equal(t, float64(512000*1024), samples["system.memory.free"])
+}
+
+func TestSystemMetricsGathererMalformed(t *testing.T) {
+	g := newProcfsMetricsGatherer(filepath.Join("testdata", "procfs", "malformed"))
+	_, err := g.readCPUSample()
+	assert.EqualError(t, err, "failed to parse "+filepath.Join(g.procfs, "stat"))
+
+	var m Metrics
+	assert.Error(t, g.gatherSystemMemoryMetrics(&m))
+	assert.Error(t, g.gatherProcessStatusMetrics(&m))
+
+	// A parse failure in one file should not
+	// prevent gathering metrics from the others.
+	samples, err := gatherProcfsTestdata(g)
+	assert.Error(t, err)
+	assert.Equal(t, map[string]float64{"system.process.fd.open": 1}, samples)
+}
+
+func TestSystemMetricsGathererMissing(t *testing.T) {
+	g := newProcfsMetricsGatherer(filepath.Join("testdata", "procfs", "missing"))
+	_, err := gatherProcfsTestdata(g)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func gatherProcfsTestdata(g *systemMetricsGatherer) (map[string]float64, error) {
+	var m Metrics
+	err := g.GatherMetrics(context.Background(), &m)
+	samples := make(map[string]float64)
+	for _, metrics := range m.metrics {
+		for name, sample := range metrics.Samples {
+			if sample.Value != nil {
+				samples[name] = *sample.Value
+			}
+		}
+	}
+	return samples, err
+}
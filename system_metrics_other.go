@@ -0,0 +1,9 @@
+//+build !linux
+
+package elasticapm
+
+// newSystemMetricsGatherer returns nil, as system
+// metrics are currently only gathered on Linux.
+func newSystemMetricsGatherer() MetricsGatherer {
+	return nil
+}
@@ -189,6 +189,8 @@ type Tracer struct {
 	captureBodyMu sync.RWMutex
 	captureBody   CaptureBodyMode
 
+	metricsRegistry *MetricsRegistry
+
 	errorPool       sync.Pool
 	spanPool        sync.Pool
 	transactionPool sync.Pool
@@ -233,6 +235,7 @@ func newTracer(opts options) *Tracer {
 		captureBody:           opts.captureBody,
 		spanFramesMinDuration: opts.spanFramesMinDuration,
 		active:                opts.active,
+		metricsRegistry:       newMetricsRegistry(),
 	}
 	t.Service.Name = opts.serviceName
 	t.Service.Version = opts.serviceVersion
@@ -249,10 +252,18 @@ func newTracer(opts options) *Tracer {
 		cfg.flushInterval = opts.flushInterval
 		cfg.maxTransactionQueueSize = opts.maxTransactionQueueSize
 		cfg.maxErrorQueueSize = defaultMaxErrorQueueSize
+		cfg.maxMetricLabelSets = defaultMaxMetricLabelSets
+		cfg.maxMetricLabelSetsPerName = defaultMaxMetricLabelSetsPerName
 		cfg.sanitizedFieldNames = opts.sanitizedFieldNames
 		cfg.preContext = defaultPreContext
 		cfg.postContext = defaultPostContext
-		cfg.metricsGatherers = []MetricsGatherer{&builtinMetricsGatherer{tracer: t}}
+		cfg.metricsGatherers = []MetricsGatherer{&builtinMetricsGatherer{tracer: t}, t.metricsRegistry}
+		if g := newSystemMetricsGatherer(); g != nil {
+			cfg.metricsGatherers = append(cfg.metricsGatherers, g)
+		}
+		if g := newCgroupMetricsGatherer(); g != nil {
+			cfg.metricsGatherers = append(cfg.metricsGatherers, g)
+		}
 	}
 	return t
 }
@@ -324,6 +335,28 @@ func (t *Tracer) SetMaxErrorQueueSize(n int) {
 	})
 }
 
+// SetMaxMetricLabelSets sets the maximum number of distinct label
+// sets gathered for metrics in total. Once the limit is reached,
+// samples with new label sets are collapsed into a single label set
+// with the label "_other", and counted by the metric
+// "elasticapm.metrics.overflowed". Unlabeled samples are never
+// collapsed. If set to a non-positive value, there is no limit.
+func (t *Tracer) SetMaxMetricLabelSets(n int) {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.maxMetricLabelSets = n
+	})
+}
+
+// SetMaxMetricLabelSetsPerName sets the maximum number of distinct
+// label sets gathered for each metric name. Samples exceeding the
+// limit are collapsed as described for SetMaxMetricLabelSets. If set
+// to a non-positive value, there is no limit.
+func (t *Tracer) SetMaxMetricLabelSetsPerName(n int) {
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.maxMetricLabelSetsPerName = n
+	})
+}
+
 // SetContextSetter sets the stacktrace.ContextSetter to be used for
 // setting stacktrace source context. If nil (which is the initial
 // value), no context will be set.
@@ -388,6 +421,62 @@ func (t *Tracer) RegisterMetricsGatherer(g MetricsGatherer) func() {
 	}
 }
 
+// AddErrorFilter adds f to the set of filters applied to errors
+// before they are sent to the Elastic APM server. Filters are
+// applied in the order in which they are added.
+//
+// AddErrorFilter returns a function which will remove f.
+// It may safely be called multiple times.
+func (t *Tracer) AddErrorFilter(f ErrorFilter) func() {
+	// Wrap f in a pointer-to-struct, so we can safely compare.
+	wrapped := &struct{ ErrorFilter }{ErrorFilter: f}
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.errorFilters = append(cfg.errorFilters, wrapped)
+	})
+	remove := func(cfg *tracerConfig) {
+		for i, f := range cfg.errorFilters {
+			if f != wrapped {
+				continue
+			}
+			cfg.errorFilters = append(cfg.errorFilters[:i], cfg.errorFilters[i+1:]...)
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.sendConfigCommand(remove)
+		})
+	}
+}
+
+// AddTransactionFilter adds f to the set of filters applied to
+// transactions before they are sent to the Elastic APM server.
+// Filters are applied in the order in which they are added.
+//
+// AddTransactionFilter returns a function which will remove f.
+// It may safely be called multiple times.
+func (t *Tracer) AddTransactionFilter(f TransactionFilter) func() {
+	// Wrap f in a pointer-to-struct, so we can safely compare.
+	wrapped := &struct{ TransactionFilter }{TransactionFilter: f}
+	t.sendConfigCommand(func(cfg *tracerConfig) {
+		cfg.transactionFilters = append(cfg.transactionFilters, wrapped)
+	})
+	remove := func(cfg *tracerConfig) {
+		for i, f := range cfg.transactionFilters {
+			if f != wrapped {
+				continue
+			}
+			cfg.transactionFilters = append(cfg.transactionFilters[:i], cfg.transactionFilters[i+1:]...)
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.sendConfigCommand(remove)
+		})
+	}
+}
+
 func (t *Tracer) sendConfigCommand(cmd tracerConfigCommand) {
 	select {
 	case t.configCommands <- cmd:
@@ -428,6 +517,13 @@ func (t *Tracer) SetCaptureBody(mode CaptureBodyMode) {
 	t.captureBodyMu.Unlock()
 }
 
+// CaptureBody returns the HTTP request body capture mode.
+func (t *Tracer) CaptureBody() CaptureBodyMode {
+	t.captureBodyMu.RLock()
+	defer t.captureBodyMu.RUnlock()
+	return t.captureBody
+}
+
 // SendMetrics forces the tracer to gather and send metrics immediately,
 // blocking until the metrics have been sent or the abort channel is
 // signalled.
@@ -663,15 +759,19 @@ func (t *Tracer) loop() {
 // tracerConfig holds the tracer's runtime configuration, which may be modified
 // by sending a tracerConfigCommand to the tracer's configCommands channel.
 type tracerConfig struct {
-	flushInterval           time.Duration
-	metricsInterval         time.Duration
-	maxTransactionQueueSize int
-	maxErrorQueueSize       int
-	logger                  Logger
-	metricsGatherers        []MetricsGatherer
-	contextSetter           stacktrace.ContextSetter
-	preContext, postContext int
-	sanitizedFieldNames     *regexp.Regexp
+	flushInterval             time.Duration
+	metricsInterval           time.Duration
+	maxTransactionQueueSize   int
+	maxErrorQueueSize         int
+	maxMetricLabelSets        int
+	maxMetricLabelSetsPerName int
+	logger                    Logger
+	metricsGatherers          []MetricsGatherer
+	errorFilters              []ErrorFilter
+	transactionFilters        []TransactionFilter
+	contextSetter             stacktrace.ContextSetter
+	preContext, postContext   int
+	sanitizedFieldNames       *regexp.Regexp
 }
 
 type tracerConfigCommand func(*tracerConfig)
@@ -2,11 +2,13 @@ package elasticapm
 
 // TracerStats holds statistics for a Tracer.
 type TracerStats struct {
-	Errors              TracerStatsErrors
-	ErrorsSent          uint64
-	ErrorsDropped       uint64
-	TransactionsSent    uint64
-	TransactionsDropped uint64
+	Errors               TracerStatsErrors
+	ErrorsSent           uint64
+	ErrorsDropped        uint64
+	ErrorsFiltered       uint64
+	TransactionsSent     uint64
+	TransactionsDropped  uint64
+	TransactionsFiltered uint64
 }
 
 // TracerStatsErrors holds error statistics for a Tracer.
@@ -28,6 +30,8 @@ func (s *TracerStats) accumulate(rhs TracerStats) {
 	s.Errors.SendErrors += rhs.Errors.SendErrors
 	s.ErrorsSent += rhs.ErrorsSent
 	s.ErrorsDropped += rhs.ErrorsDropped
+	s.ErrorsFiltered += rhs.ErrorsFiltered
 	s.TransactionsSent += rhs.TransactionsSent
 	s.TransactionsDropped += rhs.TransactionsDropped
+	s.TransactionsFiltered += rhs.TransactionsFiltered
 }
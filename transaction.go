@@ -6,6 +6,8 @@ import (
 	"math/rand"
 	"sync"
 	"time"
+
+	"github.com/elastic/apm-agent-go/model"
 )
 
 // StartTransaction returns a new Transaction with the specified
@@ -72,6 +74,7 @@ type Transaction struct {
 
 	tracer                *Tracer
 	sampled               bool
+	filtered              bool
 	maxSpans              int
 	spanFramesMinDuration time.Duration
 
@@ -105,6 +108,17 @@ func (tx *Transaction) Discard() {
 	tx.tracer.transactionPool.Put(tx)
 }
 
+// ID returns the unique ID of the transaction, which is generated
+// when the transaction is started.
+func (tx *Transaction) ID() model.UUID {
+	return tx.id
+}
+
+// Tracer returns the Tracer which started the transaction.
+func (tx *Transaction) Tracer() *Tracer {
+	return tx.tracer
+}
+
 // Sampled reports whether or not the transaction is sampled.
 func (tx *Transaction) Sampled() bool {
 	return tx.sampled
@@ -113,6 +113,23 @@ func TestValidateContextTags(t *testing.T) {
 	})
 }
 
+func TestValidateSpanContextTags(t *testing.T) {
+	t.Run("long_value", func(t *testing.T) {
+		validateTransaction(t, func(tx *elasticapm.Transaction) {
+			span := tx.StartSpan("name", "type", nil)
+			span.Context.SetTag("x", strings.Repeat("x", 1025))
+			span.End()
+		})
+	})
+	t.Run("reserved_key_chars", func(t *testing.T) {
+		validateTransaction(t, func(tx *elasticapm.Transaction) {
+			span := tx.StartSpan("name", "type", nil)
+			span.Context.SetTag("x.y", "z")
+			span.End()
+		})
+	})
+}
+
 func TestValidateRequestMethod(t *testing.T) {
 	validateTransaction(t, func(tx *elasticapm.Transaction) {
 		req, _ := http.NewRequest(strings.Repeat("x", 1025), "/", nil)